@@ -0,0 +1,80 @@
+package go_fastdfs
+
+import (
+	"errors"
+	"net"
+)
+
+//改写tracker返回的storage地址，用于NAT或者容器网络
+//storage连接地址为ip:port，FileInfo.Address为ip
+type AddrMapper func(addr string) string
+
+//静态地址表
+//先按完整地址查找，ip:port没有命中时再按ip查找并保留端口
+func StaticAddrMap(m map[string]string) AddrMapper {
+	return func(addr string) string {
+		if to, ok := m[addr]; ok {
+			return to
+		}
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return addr
+		}
+		if to, ok := m[host]; ok {
+			return net.JoinHostPort(to, port)
+		}
+		return addr
+	}
+}
+
+//把from网段内的ip改写到to网段，保留主机位和端口
+//两个网段的掩码长度必须相同
+func CIDRAddrMap(from, to string) (AddrMapper, error) {
+	_, fromNet, err := net.ParseCIDR(from)
+	if err != nil {
+		return nil, err
+	}
+	_, toNet, err := net.ParseCIDR(to)
+	if err != nil {
+		return nil, err
+	}
+
+	fromOnes, fromBits := fromNet.Mask.Size()
+	toOnes, toBits := toNet.Mask.Size()
+	if fromOnes != toOnes || fromBits != toBits {
+		return nil, errors.New("fastdfs: cidr mask size mismatch")
+	}
+
+	rewrite := func(host string) string {
+		ip := net.ParseIP(host)
+		if ip == nil || !fromNet.Contains(ip) {
+			return host
+		}
+		if ip4 := ip.To4(); ip4 != nil && len(fromNet.IP) == net.IPv4len {
+			ip = ip4
+		}
+
+		out := make(net.IP, len(ip))
+		for i := range ip {
+			out[i] = toNet.IP[i] | (ip[i] &^ toNet.Mask[i])
+		}
+		return out.String()
+	}
+
+	return func(addr string) string {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return rewrite(addr)
+		}
+		return net.JoinHostPort(rewrite(host), port)
+	}, nil
+}
+
+//按照Options.AddrMapper改写地址
+func (c *FastdfsClient) mapAddr(addr string) string {
+	if c.opt.AddrMapper == nil || addr == "" {
+		return addr
+	}
+	return c.opt.AddrMapper(addr)
+}
@@ -0,0 +1,140 @@
+package go_fastdfs
+
+import (
+	"sync"
+)
+
+//批量操作中单个fileid的结果
+type FileInfoResult struct {
+	Fileid string
+	Info   *FileInfo
+	Err    error
+}
+
+//批量删除中单个fileid的结果
+type DeleteResult struct {
+	Fileid string
+	Err    error
+}
+
+//批量获取文件信息，结果与fileids的顺序一致
+//能从文件名解析的在本地解析，其余的先向tracker查询所在storage，
+//再按storage分组，每个storage最多concurrency个并发查询
+func (c *FastdfsClient) FileInfos(fileids []string, concurrency int) []FileInfoResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]FileInfoResult, len(fileids))
+	var remote []int
+	for i, fileid := range fileids {
+		results[i].Fileid = fileid
+
+		_, remoteName, err := splitFileid(fileid)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		info, err := c.decodeFileInfo(remoteName)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if info == nil {
+			remote = append(remote, i)
+			continue
+		}
+		results[i].Info = info
+	}
+
+	//向tracker查询所在的storage
+	storages := make([]*Storage, len(fileids))
+	runLimited(remote, concurrency, func(i int) {
+		groupName, remoteName, _ := splitFileid(fileids[i])
+		storages[i], results[i].Err = c.queryFetchStorage(groupName, remoteName)
+	})
+
+	//按storage分组查询
+	runPerStorage(remote, storages, concurrency, func(i int) {
+		err := c.withRetry(func() error {
+			var err error
+			results[i].Info, err = storages[i].queryFileInfo(0)
+			return err
+		})
+		results[i].Err = err
+	})
+
+	return results
+}
+
+//批量删除文件，结果与fileids的顺序一致
+//先向tracker查询源storage，再按storage分组，每个storage最多concurrency个并发删除
+//删除请求不重试，失败的fileid需要调用方确认后再处理
+func (c *FastdfsClient) DeleteFiles(fileids []string, concurrency int) []DeleteResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]DeleteResult, len(fileids))
+	var idxs []int
+	for i, fileid := range fileids {
+		results[i].Fileid = fileid
+		if _, _, err := splitFileid(fileid); err != nil {
+			results[i].Err = err
+			continue
+		}
+		idxs = append(idxs, i)
+	}
+
+	//向tracker查询源storage
+	storages := make([]*Storage, len(fileids))
+	runLimited(idxs, concurrency, func(i int) {
+		groupName, remoteName, _ := splitFileid(fileids[i])
+		storages[i], results[i].Err = c.queryStorage(groupName, remoteName, TRACKER_PROTO_CMD_SERVICE_QUERY_UPDATE)
+	})
+
+	runPerStorage(idxs, storages, concurrency, func(i int) {
+		results[i].Err = storages[i].deleteFile()
+	})
+
+	return results
+}
+
+//按storage分组，不同storage并行，每个storage最多concurrency个并发调用fn
+//storages[i]为nil的跳过
+func runPerStorage(idxs []int, storages []*Storage, concurrency int, fn func(i int)) {
+	groups := make(map[string][]int)
+	for _, i := range idxs {
+		if storages[i] != nil {
+			groups[storages[i].addr] = append(groups[storages[i].addr], i)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, idxs := range groups {
+		wg.Add(1)
+		go func(idxs []int) {
+			defer wg.Done()
+			runLimited(idxs, concurrency, fn)
+		}(idxs)
+	}
+	wg.Wait()
+}
+
+//对idxs中的每一项调用fn，最多n个并发
+func runLimited(idxs []int, n int, fn func(i int)) {
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for _, i := range idxs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
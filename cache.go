@@ -0,0 +1,179 @@
+package go_fastdfs
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+type CacheOptions struct {
+	MemoryBytes int64  //内存缓存的最大字节数，0不使用内存缓存
+	Dir         string //磁盘缓存目录，空不使用磁盘缓存
+	DiskBytes   int64  //磁盘缓存的最大字节数
+	MaxFileSize int64  //超过此大小的文件不缓存，默认8MB
+}
+
+//在FastdfsClient的下载前加一层按fileid缓存完整文件的LRU缓存
+//以FileInfo的大小和crc32作为校验值，不一致的缓存会被丢弃
+//同一个fileid并发未命中时只从存储下载一次
+type CachedClient struct {
+	*FastdfsClient
+
+	opt  CacheOptions
+	mem  *lruCache
+	disk *diskCache
+
+	flightMu sync.Mutex
+	flights  map[string]*cacheFlight
+}
+
+//正在下载的请求
+type cacheFlight struct {
+	wg    sync.WaitGroup
+	entry *cacheEntry
+	err   error
+}
+
+func NewCachedClient(c *FastdfsClient, opt CacheOptions) (*CachedClient, error) {
+	if opt.MaxFileSize == 0 {
+		opt.MaxFileSize = 8 << 20
+	}
+
+	cc := &CachedClient{
+		FastdfsClient: c,
+		opt:           opt,
+		flights:       make(map[string]*cacheFlight),
+	}
+	if opt.MemoryBytes > 0 {
+		cc.mem = newLRUCache(opt.MemoryBytes)
+	}
+	if opt.Dir != "" && opt.DiskBytes > 0 {
+		disk, err := newDiskCache(opt.Dir, opt.DiskBytes)
+		if err != nil {
+			return nil, err
+		}
+		cc.disk = disk
+	}
+
+	return cc, nil
+}
+
+//优先从缓存读取，参数与FastdfsClient.DownloadToWrite相同
+func (cc *CachedClient) DownloadToWrite(w io.Writer, fileid string, offset, size int64) (int, error) {
+	if offset < 0 || size < 0 {
+		return 0, errors.New("fastdfs: negative offset or size")
+	}
+	info, err := cc.FileInfo(fileid)
+	if err != nil {
+		return 0, err
+	}
+	if info.FileSize < 0 || info.FileSize > cc.opt.MaxFileSize {
+		return cc.FastdfsClient.DownloadToWrite(w, fileid, offset, size)
+	}
+
+	e, err := cc.get(fileid, info)
+	if err != nil {
+		return 0, err
+	}
+
+	data := e.data
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if size > 0 && size < int64(len(data)) {
+		data = data[:size]
+	}
+	return w.Write(data)
+}
+
+//从缓存中移除fileid
+func (cc *CachedClient) Invalidate(fileid string) {
+	if cc.mem != nil {
+		cc.mem.remove(fileid)
+	}
+	if cc.disk != nil {
+		cc.disk.remove(fileid)
+	}
+}
+
+//依次查找内存缓存、磁盘缓存，都未命中时下载
+func (cc *CachedClient) get(fileid string, info *FileInfo) (*cacheEntry, error) {
+	valid := func(e *cacheEntry) bool {
+		return e.size == info.FileSize && e.crc32 == uint32(info.Crc32)
+	}
+
+	if cc.mem != nil {
+		if e, ok := cc.mem.get(fileid); ok {
+			if valid(e) {
+				return e, nil
+			}
+			cc.mem.remove(fileid)
+		}
+	}
+
+	if cc.disk != nil {
+		if e, err := cc.disk.get(fileid); err == nil {
+			if valid(e) {
+				if cc.mem != nil {
+					cc.mem.add(e)
+				}
+				return e, nil
+			}
+			cc.disk.remove(fileid)
+		}
+	}
+
+	return cc.fetch(fileid, info)
+}
+
+//下载完整文件并放入缓存，同一个fileid同时只有一个下载
+func (cc *CachedClient) fetch(fileid string, info *FileInfo) (*cacheEntry, error) {
+	cc.flightMu.Lock()
+	if f, ok := cc.flights[fileid]; ok {
+		cc.flightMu.Unlock()
+		f.wg.Wait()
+		return f.entry, f.err
+	}
+	f := &cacheFlight{}
+	f.wg.Add(1)
+	cc.flights[fileid] = f
+	cc.flightMu.Unlock()
+
+	f.entry, f.err = cc.download(fileid, info)
+	f.wg.Done()
+
+	cc.flightMu.Lock()
+	delete(cc.flights, fileid)
+	cc.flightMu.Unlock()
+
+	return f.entry, f.err
+}
+
+//下载完整文件，与FileInfo一致时才放入缓存，不一致时返回*ChecksumError
+func (cc *CachedClient) download(fileid string, info *FileInfo) (*cacheEntry, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, info.FileSize))
+	if _, err := cc.FastdfsClient.DownloadToWrite(buf, fileid, 0, 0); err != nil {
+		return nil, err
+	}
+
+	e := &cacheEntry{
+		key:   fileid,
+		size:  int64(buf.Len()),
+		crc32: crc32.ChecksumIEEE(buf.Bytes()),
+		data:  buf.Bytes(),
+	}
+	if e.size != info.FileSize || e.crc32 != uint32(info.Crc32) {
+		return nil, &ChecksumError{Fileid: fileid, Expected: uint32(info.Crc32), Actual: e.crc32}
+	}
+
+	if cc.mem != nil {
+		cc.mem.add(e)
+	}
+	if cc.disk != nil {
+		cc.disk.add(fileid, e)
+	}
+	return e, nil
+}
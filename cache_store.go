@@ -0,0 +1,233 @@
+package go_fastdfs
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+//缓存的完整文件，size和crc32来自FileInfo，作为校验值
+type cacheEntry struct {
+	key   string
+	size  int64
+	crc32 uint32
+	data  []byte //磁盘缓存中为nil
+}
+
+//按字节数限制的LRU
+type lruCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+
+	onEvict func(e *cacheEntry)
+}
+
+func newLRUCache(maxBytes int64) *lruCache {
+	return &lruCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*cacheEntry), true
+}
+
+//加入缓存，超过maxBytes时淘汰最久未使用的
+func (c *lruCache) add(e *cacheEntry) {
+	if e.size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	//替换已有的项，不触发onEvict
+	if el, ok := c.items[e.key]; ok {
+		c.removeElement(el, false)
+	}
+	c.items[e.key] = c.ll.PushFront(e)
+	c.curBytes += e.size
+
+	for c.curBytes > c.maxBytes {
+		c.removeElement(c.ll.Back(), true)
+	}
+}
+
+func (c *lruCache) remove(key string) {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el, true)
+	}
+	c.mu.Unlock()
+}
+
+//调用方mu.Lock
+func (c *lruCache) removeElement(el *list.Element, evict bool) {
+	e := c.ll.Remove(el).(*cacheEntry)
+	delete(c.items, e.key)
+	c.curBytes -= e.size
+	if evict && c.onEvict != nil {
+		c.onEvict(e)
+	}
+}
+
+//磁盘缓存文件头：crc32(4) + size(8)
+const diskCacheHeaderLen = 12
+
+//磁盘上的LRU缓存，每个文件一个缓存文件，文件名为fileid的sha1
+type diskCache struct {
+	dir string
+	lru *lruCache
+}
+
+//打开磁盘缓存，已有的缓存文件按修改时间恢复到LRU中
+func newDiskCache(dir string, maxBytes int64) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	d := &diskCache{
+		dir: dir,
+		lru: newLRUCache(maxBytes),
+	}
+	d.lru.onEvict = func(e *cacheEntry) {
+		os.Remove(d.path(e.key))
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	for _, fi := range infos {
+		if fi.IsDir() {
+			continue
+		}
+		//上次没有完成的临时文件
+		if filepath.Ext(fi.Name()) == ".tmp" {
+			os.Remove(filepath.Join(dir, fi.Name()))
+			continue
+		}
+		e, err := d.readHeader(fi.Name())
+		if err != nil {
+			os.Remove(filepath.Join(dir, fi.Name()))
+			continue
+		}
+		d.lru.add(e)
+	}
+
+	return d, nil
+}
+
+func (d *diskCache) key(fileid string) string {
+	sum := sha1.Sum([]byte(fileid))
+	return hex.EncodeToString(sum[:])
+}
+
+func (d *diskCache) path(key string) string {
+	return filepath.Join(d.dir, key)
+}
+
+func (d *diskCache) readHeader(key string) (*cacheEntry, error) {
+	f, err := os.Open(d.path(key))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var h [diskCacheHeaderLen]byte
+	if _, err := io.ReadFull(f, h[:]); err != nil {
+		return nil, err
+	}
+	return &cacheEntry{
+		key:   key,
+		crc32: binary.BigEndian.Uint32(h[0:]),
+		size:  int64(binary.BigEndian.Uint64(h[4:])),
+	}, nil
+}
+
+//读取缓存文件，不存在或损坏时返回错误
+//重新计算数据的crc32，与记录的不一致时视为损坏并删除
+func (d *diskCache) get(fileid string) (*cacheEntry, error) {
+	key := d.key(fileid)
+	e, ok := d.lru.get(key)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	b, err := ioutil.ReadFile(d.path(key))
+	if err != nil || int64(len(b)) != diskCacheHeaderLen+e.size ||
+		crc32.ChecksumIEEE(b[diskCacheHeaderLen:]) != e.crc32 {
+		d.lru.remove(key)
+		return nil, errors.New("fastdfs: broken cache file")
+	}
+
+	return &cacheEntry{
+		key:   fileid,
+		size:  e.size,
+		crc32: e.crc32,
+		data:  b[diskCacheHeaderLen:],
+	}, nil
+}
+
+//写入缓存文件，先写临时文件再改名
+func (d *diskCache) add(fileid string, e *cacheEntry) error {
+	if e.size > d.lru.maxBytes {
+		return nil
+	}
+
+	key := d.key(fileid)
+	tmp, err := ioutil.TempFile(d.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	var h [diskCacheHeaderLen]byte
+	binary.BigEndian.PutUint32(h[0:], e.crc32)
+	binary.BigEndian.PutUint64(h[4:], uint64(e.size))
+	_, err = tmp.Write(h[:])
+	if err == nil {
+		_, err = tmp.Write(e.data)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), d.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	d.lru.add(&cacheEntry{key: key, size: e.size, crc32: e.crc32})
+	return nil
+}
+
+func (d *diskCache) remove(fileid string) {
+	d.lru.remove(d.key(fileid))
+}
@@ -0,0 +1,212 @@
+package go_fastdfs
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestEntry(key string, size int) *cacheEntry {
+	d := fakeData(size)
+	return &cacheEntry{
+		key:   key,
+		size:  int64(size),
+		crc32: crc32.ChecksumIEEE(d),
+		data:  d,
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(100)
+	var evicted []string
+	c.onEvict = func(e *cacheEntry) {
+		evicted = append(evicted, e.key)
+	}
+
+	c.add(newTestEntry("a", 40))
+	c.add(newTestEntry("b", 40))
+	if c.curBytes != 80 {
+		t.Fatalf("curBytes = %d", c.curBytes)
+	}
+
+	//访问a之后，b是最久未使用的
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("a not found")
+	}
+	c.add(newTestEntry("c", 40))
+	if _, ok := c.get("b"); ok {
+		t.Fatal("b should be evicted")
+	}
+	if c.curBytes != 80 || len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("curBytes = %d, evicted = %v", c.curBytes, evicted)
+	}
+
+	//替换已有的项只调整字节数，不触发onEvict
+	c.add(newTestEntry("a", 10))
+	if c.curBytes != 50 || len(evicted) != 1 {
+		t.Fatalf("curBytes = %d, evicted = %v", c.curBytes, evicted)
+	}
+
+	//超过maxBytes的项不缓存
+	c.add(newTestEntry("big", 101))
+	if _, ok := c.get("big"); ok || c.curBytes != 50 {
+		t.Fatalf("big cached, curBytes = %d", c.curBytes)
+	}
+
+	c.remove("c")
+	if _, ok := c.get("c"); ok || c.curBytes != 10 || evicted[len(evicted)-1] != "c" {
+		t.Fatalf("curBytes = %d, evicted = %v", c.curBytes, evicted)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fdfs-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := newDiskCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newTestEntry("group1/a", 40)
+	if err := d.add("group1/a", a); err != nil {
+		t.Fatal(err)
+	}
+	e, err := d.get("group1/a")
+	if err != nil || !bytes.Equal(e.data, a.data) || e.crc32 != a.crc32 || e.key != "group1/a" {
+		t.Fatalf("get: %v", err)
+	}
+
+	//超过maxBytes时删除最久未使用的缓存文件
+	time.Sleep(10 * time.Millisecond)
+	d.add("group1/b", newTestEntry("group1/b", 40))
+	time.Sleep(10 * time.Millisecond)
+	d.add("group1/c", newTestEntry("group1/c", 40))
+	if _, err := d.get("group1/a"); err == nil {
+		t.Fatal("a should be evicted")
+	}
+	if _, err := os.Stat(d.path(d.key("group1/a"))); !os.IsNotExist(err) {
+		t.Fatalf("cache file of a not removed: %v", err)
+	}
+
+	//重新打开时恢复已有的缓存，清除未完成的临时文件
+	tmp := filepath.Join(dir, d.key("group1/x")+".123.tmp")
+	if err := ioutil.WriteFile(tmp, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err = newDiskCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatalf("tmp file not removed: %v", err)
+	}
+	if d.lru.curBytes != 80 {
+		t.Fatalf("curBytes = %d", d.lru.curBytes)
+	}
+	if _, err := d.get("group1/b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.get("group1/c"); err != nil {
+		t.Fatal(err)
+	}
+
+	d.remove("group1/b")
+	if _, err := d.get("group1/b"); err == nil {
+		t.Fatal("b should be removed")
+	}
+}
+
+//长度不变但内容损坏的缓存文件不能命中
+func TestDiskCacheCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fdfs-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := newDiskCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.add("group1/a", newTestEntry("group1/a", 40))
+
+	path := d.path(d.key("group1/a"))
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1]++
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.get("group1/a"); err == nil {
+		t.Fatal("corrupt cache file was served")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("corrupt cache file not removed: %v", err)
+	}
+}
+
+//同一个fileid并发未命中时只下载一次
+func TestCachedClient(t *testing.T) {
+	name := fakeRemoteName(".jpg")
+	data := fakeData(10000)
+	f := newFakeStorage(t, map[string][]byte{name: data})
+	f.downloadDelay = 100 * time.Millisecond
+
+	c := NewClient(&Options{Addr: f.addr()})
+	defer c.Close()
+	cc, err := NewCachedClient(c, CacheOptions{MemoryBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileid := "group1/" + name
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			if _, err := cc.DownloadToWrite(&buf, fileid, 0, 0); err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Error("data mismatch")
+			}
+		}()
+	}
+	wg.Wait()
+	if n := f.downloadCount(); n != 1 {
+		t.Fatalf("downloads = %d, want 1", n)
+	}
+
+	//命中时按offset和size截取
+	var buf bytes.Buffer
+	if _, err := cc.DownloadToWrite(&buf, fileid, 100, 50); err != nil || !bytes.Equal(buf.Bytes(), data[100:150]) {
+		t.Fatalf("range from cache: %v", err)
+	}
+	if n := f.downloadCount(); n != 1 {
+		t.Fatalf("downloads = %d, want 1", n)
+	}
+
+	cc.Invalidate(fileid)
+	buf.Reset()
+	if _, err := cc.DownloadToWrite(&buf, fileid, 0, 0); err != nil || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("after invalidate: %v", err)
+	}
+	if n := f.downloadCount(); n != 2 {
+		t.Fatalf("downloads = %d, want 2", n)
+	}
+}
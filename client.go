@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"github.com/monkey92t/go_fastdfs/pool"
+	"hash/crc32"
 	"io"
 	"net"
 	"strconv"
@@ -25,29 +26,31 @@ func (c *FastdfsClient) FileInfo(fileid string) (*FileInfo, error) {
 		return nil, err
 	}
 
-	remoteNameLen := len(remoteName)
-	if remoteNameLen < (FDFS_LOGIC_FILE_PATH_LEN + FDFS_FILENAME_BASE64_LENGTH + FDFS_FILE_EXT_NAME_MAX_LEN + 1) {
-		return nil, errors.New("error: wrong fileid.")
+	fileinfo, err := c.decodeFileInfo(remoteName)
+	if err != nil {
+		return nil, err
 	}
-
-	end := FDFS_LOGIC_FILE_PATH_LEN + (FDFS_LOGIC_FILE_PATH_LEN + FDFS_FILENAME_BASE64_LENGTH)
-	var b string
-	if remoteNameLen < end {
-		b = remoteName[FDFS_LOGIC_FILE_PATH_LEN:]
-	} else {
-		b = remoteName[FDFS_LOGIC_FILE_PATH_LEN:end]
+	if fileinfo == nil {
+		return c.queryFileInfo(groupName, remoteName)
 	}
 
-	deData, err := decodeAuto(b)
+	return fileinfo, nil
+}
+
+//从文件名解析文件信息
+//slave、trunk、appender文件无法从文件名得到，返回nil，需要从存储获取
+func (c *FastdfsClient) decodeFileInfo(remoteName string) (*FileInfo, error) {
+	deData, err := decodeRemoteName(remoteName)
 	if err != nil {
 		return nil, err
 	}
 
+	remoteNameLen := len(remoteName)
 	fsize := buffToInt64(deData, 8)
 	if ((remoteNameLen > TRUNK_LOGIC_FILENAME_LENGTH) ||
 		((remoteNameLen > NORMAL_LOGIC_FILENAME_LENGTH) && ((fsize & TRUNK_FILE_MARK_SIZE) == 0))) ||
 		((fsize & APPENDER_FILE_SIZE) != 0) {
-		return c.queryFileInfo(groupName, remoteName)
+		return nil, nil
 	}
 
 	if fsize>>63 != 0 {
@@ -57,7 +60,7 @@ func (c *FastdfsClient) FileInfo(fileid string) (*FileInfo, error) {
 	}
 
 	fileinfo := &FileInfo{
-		Address:    ipToString(int(buffToInt32(deData, 0))),
+		Address:    c.mapAddr(ipToString(int(buffToInt32(deData, 0)))),
 		CreateTime: time.Unix(int64(buffToInt32(deData, 4)), 0),
 		FileSize:   fsize,
 		Crc32:      int(buffToInt32(deData, 16)),
@@ -66,48 +69,43 @@ func (c *FastdfsClient) FileInfo(fileid string) (*FileInfo, error) {
 	return fileinfo, nil
 }
 
-//从存储服务器获取文件信息
-func (c *FastdfsClient) queryFileInfo(groupName, remoteName string) (*FileInfo, error) {
-	//组装trackerHeader
-	conn, err := getConn(c.connPool)
-	if err != nil {
-		return nil, err
+//解码文件名中的base64部分
+//依次为源storage ip(4)、创建时间(4)、文件大小(8)、crc32(4)
+func decodeRemoteName(remoteName string) ([]byte, error) {
+	remoteNameLen := len(remoteName)
+	if remoteNameLen < (FDFS_LOGIC_FILE_PATH_LEN + FDFS_FILENAME_BASE64_LENGTH + FDFS_FILE_EXT_NAME_MAX_LEN + 1) {
+		return nil, errors.New("error: wrong fileid.")
 	}
 
-	defer closeConn(c.connPool, conn)
-
-	groupBytes := buildGroupName(groupName)
-
-	th := buildTrackerHeader(STORAGE_PROTO_CMD_QUERY_FILE_INFO, int64(len(groupBytes)+len(remoteName)))
+	end := FDFS_LOGIC_FILE_PATH_LEN + (FDFS_LOGIC_FILE_PATH_LEN + FDFS_FILENAME_BASE64_LENGTH)
+	var b string
+	if remoteNameLen < end {
+		b = remoteName[FDFS_LOGIC_FILE_PATH_LEN:]
+	} else {
+		b = remoteName[FDFS_LOGIC_FILE_PATH_LEN:end]
+	}
 
-	whole := new(bytes.Buffer)
-	whole.Write(th.bytes())
-	whole.Write(groupBytes)
-	whole.WriteString(remoteName)
+	return decodeAuto(b)
+}
 
-	_, err = conn.Write(whole.Bytes())
-	if err != nil {
-		return nil, err
-	}
+//从存储服务器获取文件信息
+func (c *FastdfsClient) queryFileInfo(groupName, remoteName string) (*FileInfo, error) {
+	return c.queryFileInfoFlags(groupName, remoteName, 0)
+}
 
-	buff, err := th.recvPackage(conn, STORAGE_PROTO_CMD_RESP, 3*FDFS_PROTO_PKG_LEN_SIZE+FDFS_IPADDR_SIZE)
+//带FDFS_QUERY_FINFO_FLAGS_*从存储服务器获取文件信息
+func (c *FastdfsClient) queryFileInfoFlags(groupName, remoteName string, flags int8) (*FileInfo, error) {
+	storage, err := c.queryFetchStorage(groupName, remoteName)
 	if err != nil {
 		return nil, err
 	}
 
-	fsize := buffToInt64(buff, 0)
-	ctime := buffToInt64(buff, FDFS_PROTO_PKG_LEN_SIZE)
-	crc32 := int(buffToInt64(buff, 2*FDFS_PROTO_PKG_LEN_SIZE))
-	start := 3 * FDFS_PROTO_PKG_LEN_SIZE
-	end := start + FDFS_IPADDR_SIZE
-	ipaddr := string(readStr(buff[start:end]))
-
-	return &FileInfo{
-		Address:    ipaddr,
-		CreateTime: time.Unix(ctime, 0),
-		FileSize:   fsize,
-		Crc32:      crc32,
-	}, nil
+	var info *FileInfo
+	err = c.withRetry(func() error {
+		info, err = storage.queryFileInfo(flags)
+		return err
+	})
+	return info, err
 }
 
 //func (c *FastdfsClient) DownloadToIoReader(fileid string, offset, size int64) (io.ReadCloser, int64, error) {
@@ -120,15 +118,50 @@ func (c *FastdfsClient) queryFileInfo(groupName, remoteName string) (*FileInfo,
 //}
 
 func (c *FastdfsClient) DownloadToWrite(w io.Writer, fileid string, offset, size int64) (int, error) {
+	if offset < 0 || size < 0 {
+		return 0, errors.New("fastdfs: negative offset or size")
+	}
 	groupName, remoteName, err := splitFileid(fileid)
 	if err != nil {
 		return 0, err
 	}
-	storage, err := c.queryStorage(groupName, remoteName, TRACKER_PROTO_CMD_SERVICE_QUERY_FETCH_ONE)
+	storage, err := c.queryFetchStorage(groupName, remoteName)
 	if err != nil {
 		return 0, err
 	}
-	return storage.downloadToWrite(w, offset, size)
+
+	//只有完整下载时才能校验crc32
+	if !c.opt.VerifyCrc32 || offset != 0 || size != 0 {
+		return c.downloadRetry(storage, w, offset, size, nil)
+	}
+
+	info, err := c.FileInfo(fileid)
+	if err != nil {
+		return 0, err
+	}
+
+	h := crc32.NewIEEE()
+	verify := func() error {
+		if sum := h.Sum32(); sum != uint32(info.Crc32) {
+			return &ChecksumError{Fileid: fileid, Expected: uint32(info.Crc32), Actual: sum}
+		}
+		return nil
+	}
+	return c.downloadRetry(storage, io.MultiWriter(w, h), offset, size, verify)
+}
+
+//删除文件，通过QUERY_UPDATE找到源storage
+//文件不存在时返回ErrFileNotFound，删除请求不重试
+func (c *FastdfsClient) DeleteFile(fileid string) error {
+	groupName, remoteName, err := splitFileid(fileid)
+	if err != nil {
+		return err
+	}
+	storage, err := c.queryStorage(groupName, remoteName, TRACKER_PROTO_CMD_SERVICE_QUERY_UPDATE)
+	if err != nil {
+		return err
+	}
+	return storage.deleteFile()
 }
 
 //func (c *FastdfsClient) download(groupName, remoteName string, offset, size int64) (io.ReadCloser, int64, error) {
@@ -142,7 +175,7 @@ func (c *FastdfsClient) DownloadToWrite(w io.Writer, fileid string, offset, size
 
 //获取默认链接的fastdfs pool.conn
 func (c *FastdfsClient) getPoolConn() (*pool.Conn, error) {
-	return getConn(c.connPool)
+	return c.getConn(c.connPool)
 }
 
 //根据op:port 获取一个pool.connpool
@@ -156,17 +189,7 @@ func (c *FastdfsClient) getStoragePool(addr string) (*pool.ConnPool, error) {
 		return c.connPool, nil
 	}
 
-	c.mu.Lock()
-	p, ok := c.storePools[addr]
-	if !ok {
-		poolOpt := c.getPoolOpt()
-		poolOpt.Dialer = defaultDialer(addr, c.opt.DialTimeout)
-		p = pool.NewConnPool(poolOpt)
-		c.storePools[addr] = p
-	}
-	c.mu.Unlock()
-
-	return p, nil
+	return c.stores.get(addr)
 }
 
 //根据ip:port获取一个可用的存储*pool.Conn
@@ -176,13 +199,14 @@ func (c *FastdfsClient) getStorePoolConn(addr string) (*pool.Conn, error) {
 	var err error
 
 	if addr != c.opt.Addr {
-		p, err := c.getStoragePool(addr)
+		var p *pool.ConnPool
+		p, err = c.getStoragePool(addr)
 		if err != nil {
 			return nil, err
 		}
-		conn, err = getConn(p)
+		conn, err = c.getConn(p)
 	} else {
-		conn, err = getConn(c.connPool)
+		conn, err = c.getConn(c.connPool)
 	}
 
 	if err != nil {
@@ -194,12 +218,33 @@ func (c *FastdfsClient) getStorePoolConn(addr string) (*pool.Conn, error) {
 
 //查询已有文件存储信息
 func (c *FastdfsClient) queryStorage(gname, rname string, cmd int8) (*Storage, error) {
-	conn, err := getConn(c.connPool)
+	storages, err := c.queryStorages(gname, rname, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return storages[0], nil
+}
+
+//查询已有文件的storage，QUERY_FETCH_ALL时返回组内所有可用的storage
+func (c *FastdfsClient) queryStorages(gname, rname string, cmd int8) ([]*Storage, error) {
+	var storages []*Storage
+	err := c.withRetry(func() error {
+		var err error
+		storages, err = c.queryStoragesOnce(gname, rname, cmd)
+		return err
+	})
+	return storages, err
+}
+
+func (c *FastdfsClient) queryStoragesOnce(gname, rname string, cmd int8) (_ []*Storage, err error) {
+	conn, err := c.getConn(c.connPool)
 	if err != nil {
 		return nil, err
 	}
 
-	defer closeConn(c.connPool, conn)
+	defer func() {
+		c.releaseConn(c.connPool, conn, err)
+	}()
 
 	groupBytes := buildGroupName(gname)
 
@@ -209,11 +254,13 @@ func (c *FastdfsClient) queryStorage(gname, rname string, cmd int8) (*Storage, e
 	whole.Write(groupBytes)
 	whole.WriteString(rname)
 
+	conn.SetWriteTimeout(c.opt.WriteTimeout)
 	_, err = conn.Write(whole.Bytes())
 	if err != nil {
 		return nil, err
 	}
 
+	conn.SetReadTimeout(c.opt.ReadTimeout)
 	buff, err := th.recvPackage(conn, STORAGE_PROTO_CMD_RESP, -1)
 	if err != nil {
 		return nil, err
@@ -229,18 +276,28 @@ func (c *FastdfsClient) queryStorage(gname, rname string, cmd int8) (*Storage, e
 	}
 
 	group := readStr(buff[:FDFS_GROUP_NAME_MAX_LEN])
-	ipaddr := readStr(buff[FDFS_GROUP_NAME_MAX_LEN : FDFS_GROUP_NAME_MAX_LEN+FDFS_IPADDR_SIZE-1])
+	ipaddrs := []string{readStr(buff[FDFS_GROUP_NAME_MAX_LEN : FDFS_GROUP_NAME_MAX_LEN+FDFS_IPADDR_SIZE-1])}
 	port := buffToInt64(buff, FDFS_GROUP_NAME_MAX_LEN+FDFS_IPADDR_SIZE-1)
 
-	addr := net.JoinHostPort(ipaddr, strconv.FormatInt(port, 10))
-	p, err := c.getStoragePool(addr)
-	if err != nil {
-		return nil, err
+	//QUERY_FETCH_ALL时后面是同端口的其他storage的ip
+	for start := TRACKER_QUERY_STORAGE_FETCH_BODY_LEN; start < blen; start += FDFS_IPADDR_SIZE - 1 {
+		ipaddrs = append(ipaddrs, readStr(buff[start:start+FDFS_IPADDR_SIZE-1]))
+	}
+
+	storages := make([]*Storage, 0, len(ipaddrs))
+	for _, ipaddr := range ipaddrs {
+		addr := c.mapAddr(net.JoinHostPort(ipaddr, strconv.FormatInt(port, 10)))
+		p, err := c.getStoragePool(addr)
+		if err != nil {
+			return nil, err
+		}
+		storages = append(storages, &Storage{
+			client:     c,
+			addr:       addr,
+			groupName:  group,
+			remoteName: rname,
+			connPool:   p,
+		})
 	}
-	return &Storage{
-		addr:       net.JoinHostPort(ipaddr, strconv.FormatInt(port, 10)),
-		groupName:  group,
-		remoteName: rname,
-		connPool:   p,
-	}, nil
+	return storages, nil
 }
@@ -2,12 +2,25 @@ package go_fastdfs
 
 import (
 	"github.com/monkey92t/go_fastdfs/pool"
+	"time"
+)
+
+//连接复用和放回连接池时的检测方式
+type HealthCheckPolicy int
+
+const (
+	//不阻塞地检测读缓冲和socket，空闲超过ActiveTestInterval的连接复用前再发送ACTIVE_TEST
+	HealthCheckPeek HealthCheckPolicy = iota
+	//每次复用和放回都发送ACTIVE_TEST
+	HealthCheckActiveTest
+	//不做检测
+	HealthCheckNone
 )
 
 //从一个pool中获取一个连接池的链接
 //并检测可用性
 //如果是连接池中不可用的conn，或者不是纯洁的conn，则会从连接池中删除它
-func getConn(p *pool.ConnPool) (*pool.Conn, error) {
+func (c *FastdfsClient) getConn(p *pool.ConnPool) (*pool.Conn, error) {
 	for {
 		conn, isnew, err := p.Get()
 		if err != nil {
@@ -17,7 +30,7 @@ func getConn(p *pool.ConnPool) (*pool.Conn, error) {
 			return conn, nil
 		}
 
-		if checkConnPure(conn) {
+		if c.checkReusedConn(conn) {
 			return conn, nil
 		}
 
@@ -27,25 +40,75 @@ func getConn(p *pool.ConnPool) (*pool.Conn, error) {
 
 //把一个连接放入指定连接池，放入之前检测是否是干净的连接
 //如果是不干净的，则会关闭它
-func closeConn(p *pool.ConnPool, c *pool.Conn) {
-	if c == nil {
+func (c *FastdfsClient) closeConn(p *pool.ConnPool, conn *pool.Conn) {
+	if conn == nil {
 		return
 	}
-	if checkConnPure(c) {
-		p.Put(c)
+	//清除读写超时，放回后不影响连接的检测
+	conn.SetDeadline(time.Time{})
+	if c.checkReturnedConn(conn) {
+		p.Put(conn)
 	} else {
-		p.Remove(c)
+		p.Remove(conn)
+	}
+}
+
+//操作结束后释放连接
+//err为网络错误时计入熔断器并关闭连接，否则按照closeConn放回
+func (c *FastdfsClient) releaseConn(p *pool.ConnPool, conn *pool.Conn, err error) {
+	if conn == nil {
+		return
+	}
+	if err != nil && IsRetryableError(err) {
+		p.ReportFailure()
+		p.Remove(conn)
+		return
+	}
+	c.closeConn(p, conn)
+}
+
+//按照HealthCheck检测从连接池中取出的连接
+func (c *FastdfsClient) checkReusedConn(conn *pool.Conn) bool {
+	switch c.opt.HealthCheck {
+	case HealthCheckNone:
+		return true
+	case HealthCheckActiveTest:
+		return c.checkConnPure(conn)
+	}
+
+	if conn.CheckPure() != nil {
+		return false
+	}
+	if c.opt.ActiveTestInterval > 0 && time.Since(conn.UsedAt()) > c.opt.ActiveTestInterval {
+		return c.checkConnPure(conn)
 	}
+	return true
+}
+
+//按照HealthCheck检测将要放回连接池的连接
+func (c *FastdfsClient) checkReturnedConn(conn *pool.Conn) bool {
+	switch c.opt.HealthCheck {
+	case HealthCheckNone:
+		return true
+	case HealthCheckActiveTest:
+		return c.checkConnPure(conn)
+	}
+
+	return conn.CheckPure() == nil
 }
 
 //检测一个连接的是否是可用而且干净的
 //true 可用而且干净的
 //false 不可用或者不干净的
-func checkConnPure(conn *pool.Conn) bool {
+func (c *FastdfsClient) checkConnPure(conn *pool.Conn) bool {
+	defer conn.SetDeadline(time.Time{})
+
 	th := buildTrackerHeader(FDFS_PROTO_CMD_ACTIVE_TEST, 0)
+	conn.SetWriteTimeout(c.opt.WriteTimeout)
 	if err := th.sendHeader(conn); err != nil {
 		return false
 	}
+	conn.SetReadTimeout(c.opt.ReadTimeout)
 	if err := th.recvHeader(conn, TRACKER_PROTO_CMD_RESP, -1); err != nil {
 		return false
 	}
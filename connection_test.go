@@ -0,0 +1,197 @@
+package go_fastdfs
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//本地的tracker和storage，tracker查询返回自身的地址
+//支持ACTIVE_TEST、查询storage、查询文件信息、下载和删除
+type fakeStorage struct {
+	ln net.Listener
+
+	mu            sync.Mutex
+	files         map[string][]byte
+	downloads     int           //收到的下载请求数
+	downloadDelay time.Duration //每次下载前的等待
+}
+
+func newFakeStorage(tb testing.TB, files map[string][]byte) *fakeStorage {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if files == nil {
+		files = make(map[string][]byte)
+	}
+
+	f := &fakeStorage{ln: ln, files: files}
+	go f.serve()
+	tb.Cleanup(func() { ln.Close() })
+	return f
+}
+
+func (f *fakeStorage) addr() string {
+	return f.ln.Addr().String()
+}
+
+func (f *fakeStorage) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeStorage) handle(conn net.Conn) {
+	defer conn.Close()
+
+	host, port, _ := net.SplitHostPort(f.addr())
+	portNum, _ := strconv.ParseInt(port, 10, 64)
+	ip := make([]byte, FDFS_IPADDR_SIZE)
+	copy(ip, host)
+
+	h := make([]byte, 10)
+	for {
+		if _, err := io.ReadFull(conn, h); err != nil {
+			return
+		}
+		body := make([]byte, buffToInt64(h, 0))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		resp := new(bytes.Buffer)
+		var status int8
+		switch int8(h[PROTO_HEADER_CMD_INDEX]) {
+		case FDFS_PROTO_CMD_ACTIVE_TEST:
+		case TRACKER_PROTO_CMD_SERVICE_QUERY_FETCH_ONE, TRACKER_PROTO_CMD_SERVICE_QUERY_UPDATE:
+			resp.Write(buildGroupName("group1"))
+			resp.Write(ip[:FDFS_IPADDR_SIZE-1])
+			resp.Write(Int64ToBuff(portNum))
+		case STORAGE_PROTO_CMD_QUERY_FILE_INFO:
+			d, ok := f.file(string(body[FDFS_GROUP_NAME_MAX_LEN:]))
+			if !ok {
+				status = FDFS_ERR_ENOENT
+				break
+			}
+			resp.Write(Int64ToBuff(int64(len(d))))
+			resp.Write(Int64ToBuff(1500000000))
+			resp.Write(Int64ToBuff(int64(crc32.ChecksumIEEE(d))))
+			resp.Write(ip)
+		case STORAGE_PROTO_CMD_DOWNLOAD_FILE:
+			offset := buffToInt64(body, 0)
+			size := buffToInt64(body, FDFS_PROTO_PKG_LEN_SIZE)
+			d, ok := f.file(string(body[2*FDFS_PROTO_PKG_LEN_SIZE+FDFS_GROUP_NAME_MAX_LEN:]))
+			if !ok {
+				status = FDFS_ERR_ENOENT
+				break
+			}
+
+			f.mu.Lock()
+			f.downloads++
+			delay := f.downloadDelay
+			f.mu.Unlock()
+			time.Sleep(delay)
+
+			if offset > int64(len(d)) {
+				offset = int64(len(d))
+			}
+			d = d[offset:]
+			if size > 0 && size < int64(len(d)) {
+				d = d[:size]
+			}
+			resp.Write(d)
+		case STORAGE_PROTO_CMD_DELETE_FILE:
+			name := string(body[FDFS_GROUP_NAME_MAX_LEN:])
+			f.mu.Lock()
+			if _, ok := f.files[name]; ok {
+				delete(f.files, name)
+			} else {
+				status = FDFS_ERR_ENOENT
+			}
+			f.mu.Unlock()
+		default:
+			return
+		}
+
+		th := buildTrackerHeader(TRACKER_PROTO_CMD_RESP, int64(resp.Len()))
+		th.status = status
+		if _, err := conn.Write(append(th.bytes(), resp.Bytes()...)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeStorage) file(name string) ([]byte, bool) {
+	f.mu.Lock()
+	d, ok := f.files[name]
+	f.mu.Unlock()
+	return d, ok
+}
+
+func (f *fakeStorage) downloadCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.downloads
+}
+
+//长度超过trunk文件名的远程文件名，文件信息只能从storage查询
+func fakeRemoteName(suffix string) string {
+	return "M00/00/00/wKgBZ1" + strings.Repeat("x", 21) + "_" + strings.Repeat("0", 24) + suffix
+}
+
+//size字节的测试数据
+func fakeData(size int) []byte {
+	d := make([]byte, size)
+	for i := range d {
+		d[i] = byte(i * 7)
+	}
+	return d
+}
+
+//一次取连接、一次请求、放回连接
+func benchmarkHealthCheck(b *testing.B, policy HealthCheckPolicy) {
+	f := newFakeStorage(b, nil)
+
+	c := NewClient(&Options{
+		Addr:        f.addr(),
+		PoolSize:    1,
+		HealthCheck: policy,
+	})
+	defer c.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conn, err := c.getConn(c.connPool)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !c.checkConnPure(conn) {
+			b.Fatal("request failed")
+		}
+		c.closeConn(c.connPool, conn)
+	}
+	b.StopTimer()
+
+	if st := c.connPool.Stats(); st.Misses != 1 {
+		b.Fatalf("connection was not reused: %+v", st)
+	}
+}
+
+func BenchmarkHealthCheckActiveTest(b *testing.B) {
+	benchmarkHealthCheck(b, HealthCheckActiveTest)
+}
+
+func BenchmarkHealthCheckPeek(b *testing.B) {
+	benchmarkHealthCheck(b, HealthCheckPeek)
+}
@@ -0,0 +1,14 @@
+package go_fastdfs
+
+import "fmt"
+
+//下载数据的crc32与存储记录的不一致
+type ChecksumError struct {
+	Fileid   string
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("fastdfs: crc32 mismatch for %s, expected %08x, got %08x", e.Fileid, e.Expected, e.Actual)
+}
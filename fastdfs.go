@@ -1,30 +1,72 @@
 package go_fastdfs
 
 import (
+	"context"
+	"crypto/tls"
 	"github.com/monkey92t/go_fastdfs/pool"
 	"net"
 	"runtime"
-	"sync"
 	"time"
 )
 
 type Options struct {
 	Addr string //ip:port
 
-	Dialer      func() (net.Conn, error)
+	Dialer      func() (net.Conn, error) //tracker的dialer，设置后优先于DialContext
 	DialTimeout time.Duration
 
+	//tracker和所有storage共用的dial函数，默认使用net.Dialer
+	//可以用于指定本地地址、keepalive、代理或者unix socket
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	AddrMapper AddrMapper //改写tracker返回的storage地址和FileInfo.Address
+
+	//不为nil时tracker和storage的连接都使用TLS，自定义的Dialer返回的连接上也会建立TLS
+	//ServerName为空时使用TLSServerNames中地址对应的名字，否则使用地址中的host
+	TLSConfig      *tls.Config
+	TLSServerNames map[string]string //ip:port或ip -> ServerName
+
+	ReadTimeout       time.Duration //每次协议交互的读超时，默认30s，-1不超时
+	WriteTimeout      time.Duration //每次协议交互的写超时，默认同ReadTimeout，-1不超时
+	StreamIdleTimeout time.Duration //下载数据流时两次读取之间的最长等待，默认同ReadTimeout，-1不超时
+
 	PoolSize           int
+	MinIdleConns       int //每个连接池(tracker和每个storage)保持的最少空闲连接数
 	PoolTimeout        time.Duration
 	IdleTimeout        time.Duration
 	IdleCheckFrequency time.Duration
+	MaxConnAge         time.Duration //连接的最大存活时间，到期后不再复用
+	MaxRequestsPerConn int           //每个连接最多使用的次数
+
+	BreakerThreshold int           //同一地址连续失败多少次后熔断，0不启用
+	BreakerCooldown  time.Duration //熔断后多久放行探测请求，默认10s
+
+	MaxStoragePools        int           //storage连接池的最大数量，0不限制
+	StoragePoolIdleTimeout time.Duration //storage连接池超过此时间未使用则关闭，-1不关闭
+
+	HealthCheck        HealthCheckPolicy //连接复用和放回时的检测方式，默认HealthCheckPeek
+	ActiveTestInterval time.Duration     //HealthCheckPeek下空闲超过此时间的连接复用前发送ACTIVE_TEST，-1不发送
+
+	ReadAheadSize int //OpenFile每次向存储预读的字节数
+
+	RetryPolicy *RetryPolicy //幂等操作的重试策略，nil不重试
+
+	//创建时间在此时间内的文件，下载和查询文件信息直接访问源storage，0不启用
+	SyncWindow time.Duration
+
+	RateLimit        RateLimit //client对所有storage的请求数和下载带宽的总限制，不含tracker查询
+	StorageRateLimit RateLimit //每个storage的请求数和下载带宽的限制
+
+	//完整下载文件时计算crc32并与存储记录的值比较
+	//不一致时返回*ChecksumError
+	VerifyCrc32 bool
 }
 
 type FastdfsClient struct {
-	storePools map[string]*pool.ConnPool
-	connPool   *pool.ConnPool
-	opt        *Options
-	mu         sync.Mutex
+	stores   *storeRegistry
+	limits   *rateLimiters
+	connPool *pool.ConnPool
+	opt      *Options
 }
 
 func NewClient(opt *Options) *FastdfsClient {
@@ -34,23 +76,61 @@ func NewClient(opt *Options) *FastdfsClient {
 		opt: opt,
 	}
 	poolOptions := c.getPoolOpt()
+	poolOptions.Dialer = trackerDialer(opt)
 	c.connPool = pool.NewConnPool(poolOptions)
-	storepool := make(map[string]*pool.ConnPool)
-	c.storePools = storepool
+	c.stores = newStoreRegistry(c)
+	c.limits = newRateLimiters(opt)
 
 	return c
 }
 
+//连接池的空闲连接由storeRegistry统一回收，连接池自身不启动reaper
 func (c *FastdfsClient) getPoolOpt() *pool.Options {
 	return &pool.Options{
-		Dialer:             c.opt.Dialer,
 		PoolSize:           c.opt.PoolSize,
+		MinIdleConns:       c.opt.MinIdleConns,
 		PoolTimeout:        c.opt.PoolTimeout,
 		IdleTimeout:        c.opt.IdleTimeout,
-		IdleCheckFrequency: c.opt.IdleCheckFrequency,
+		MaxConnAge:         c.opt.MaxConnAge,
+		MaxRequestsPerConn: c.opt.MaxRequestsPerConn,
+		BreakerThreshold:   c.opt.BreakerThreshold,
+		BreakerCooldown:    c.opt.BreakerCooldown,
 	}
 }
 
+//当前所有storage的地址和连接池统计
+func (c *FastdfsClient) StorageEndpoints() []StorageEndpoint {
+	return c.stores.endpoints()
+}
+
+//关闭client的所有连接池
+func (c *FastdfsClient) Close() error {
+	err := c.stores.close()
+	if cerr := c.connPool.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+//为tracker和已有的storage连接池预先创建MinIdleConns个连接
+//storage连接池在第一次访问该storage时才创建，刚启动时还没有，
+//需要预热的storage可以通过storageAddrs指定，为AddrMapper改写后的连接地址
+func (c *FastdfsClient) Warmup(ctx context.Context, storageAddrs ...string) error {
+	for _, addr := range storageAddrs {
+		if _, err := c.getStoragePool(addr); err != nil {
+			return err
+		}
+	}
+
+	pools := append([]*pool.ConnPool{c.connPool}, c.stores.pools()...)
+	for _, p := range pools {
+		if err := p.Warmup(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func optionsInit(opt *Options) {
 	if opt.PoolSize == 0 {
 		opt.PoolSize = 10 * runtime.NumCPU()
@@ -60,6 +140,18 @@ func optionsInit(opt *Options) {
 		opt.DialTimeout = 5 * time.Second
 	}
 
+	if opt.ReadTimeout == 0 {
+		opt.ReadTimeout = 30 * time.Second
+	}
+
+	if opt.WriteTimeout == 0 {
+		opt.WriteTimeout = opt.ReadTimeout
+	}
+
+	if opt.StreamIdleTimeout == 0 {
+		opt.StreamIdleTimeout = opt.ReadTimeout
+	}
+
 	if opt.PoolTimeout == 0 {
 		opt.PoolTimeout = opt.DialTimeout
 	}
@@ -72,20 +164,109 @@ func optionsInit(opt *Options) {
 		opt.IdleCheckFrequency = time.Minute
 	}
 
+	if opt.MinIdleConns > opt.PoolSize {
+		opt.MinIdleConns = opt.PoolSize
+	}
+
+	if opt.BreakerCooldown == 0 {
+		opt.BreakerCooldown = 10 * time.Second
+	}
+
+	if opt.StoragePoolIdleTimeout == 0 {
+		opt.StoragePoolIdleTimeout = 30 * time.Minute
+	}
+
+	if opt.ActiveTestInterval == 0 {
+		opt.ActiveTestInterval = time.Minute
+	}
+
+	if opt.ReadAheadSize == 0 {
+		opt.ReadAheadSize = 64 * 1024
+	}
+
 	if opt.Addr == "" {
 		opt.Addr = ":22122"
 	}
 
+	if opt.DialContext == nil {
+		dialer := &net.Dialer{
+			Timeout:   opt.DialTimeout,
+			KeepAlive: 5 * time.Minute,
+		}
+		opt.DialContext = dialer.DialContext
+	}
+}
+
+//tracker的dialer，没有设置Dialer时使用defaultDialer
+//opt不保存包装后的dialer，同一个Options创建多个client时不会重复建立TLS
+func trackerDialer(opt *Options) func() (net.Conn, error) {
 	if opt.Dialer == nil {
-		opt.Dialer = defaultDialer(opt.Addr, opt.IdleTimeout)
+		return defaultDialer(opt, opt.Addr)
+	}
+	if opt.TLSConfig == nil {
+		return opt.Dialer
+	}
+
+	dial := opt.Dialer
+	return func() (net.Conn, error) {
+		conn, err := dial()
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout(opt))
+		defer cancel()
+		return tlsHandshake(ctx, opt, opt.Addr, conn)
 	}
 }
 
-func defaultDialer(addr string, dialTimeout time.Duration) func() (net.Conn, error) {
-	if dialTimeout <= 0 {
-		dialTimeout = 60 * time.Second
+//dial和TLS握手的超时，默认60秒
+func dialTimeout(opt *Options) time.Duration {
+	if opt.DialTimeout <= 0 {
+		return 60 * time.Second
 	}
+	return opt.DialTimeout
+}
+
+//使用opt.DialContext连接addr，超时为opt.DialTimeout
+func defaultDialer(opt *Options, addr string) func() (net.Conn, error) {
+	timeout := dialTimeout(opt)
 	return func() (net.Conn, error) {
-		return net.DialTimeout("tcp", addr, dialTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		conn, err := opt.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		if opt.TLSConfig == nil {
+			return conn, nil
+		}
+		return tlsHandshake(ctx, opt, addr, conn)
+	}
+}
+
+//在conn上建立TLS连接
+func tlsHandshake(ctx context.Context, opt *Options, addr string, conn net.Conn) (net.Conn, error) {
+	cfg := opt.TLSConfig.Clone()
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		if name, ok := opt.TLSServerNames[addr]; ok {
+			cfg.ServerName = name
+		} else if name, ok := opt.TLSServerNames[host]; ok {
+			cfg.ServerName = name
+		} else {
+			cfg.ServerName = host
+		}
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
 	}
+	return tlsConn, nil
 }
@@ -0,0 +1,241 @@
+package go_fastdfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+)
+
+var ErrFileClosed = errors.New("fastdfs: file is closed")
+
+//远程文件的随机读取视图，实现io.ReaderAt、io.ReadSeeker、io.Closer
+//每次读取转换为一次offset/size的下载，并按照Options.ReadAheadSize预读
+type File struct {
+	c       *FastdfsClient
+	fileid  string
+	size    int64
+	info    *FileInfo
+	storage *Storage
+
+	mu     sync.Mutex
+	offset int64
+	buf    []byte //预读缓冲
+	bufOff int64  //预读缓冲对应的文件偏移
+	closed bool
+}
+
+//打开一个远程文件用于随机读取
+//能从文件名解析出大小时不访问存储，文件不存在要到读取时才会报错
+func (c *FastdfsClient) OpenFile(fileid string) (*File, error) {
+	return c.openFile(fileid, false)
+}
+
+//verify为true时总是向存储查询文件信息，文件不存在时返回ErrFileNotFound
+func (c *FastdfsClient) openFile(fileid string, verify bool) (*File, error) {
+	groupName, remoteName, err := splitFileid(fileid)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *FileInfo
+	if !verify {
+		info, err = c.FileInfo(fileid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	storage, err := c.queryFetchStorage(groupName, remoteName)
+	if err != nil {
+		return nil, err
+	}
+
+	//需要确认文件存在或者本地解析不出文件大小时，向存储查询
+	if info == nil || info.FileSize < 0 {
+		info, err = storage.queryFileInfo(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &File{
+		c:       c,
+		fileid:  fileid,
+		size:    info.FileSize,
+		info:    info,
+		storage: storage,
+	}, nil
+}
+
+//文件id
+func (f *File) Name() string {
+	return f.fileid
+}
+
+//文件大小
+func (f *File) Size() int64 {
+	return f.size
+}
+
+//实现fs.File
+func (f *File) Stat() (fs.FileInfo, error) {
+	return &fileStat{
+		name:    path.Base(f.fileid),
+		size:    f.size,
+		modTime: f.info.CreateTime,
+		info:    f.info,
+	}, nil
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return 0, ErrFileClosed
+	}
+	off := f.offset
+	f.mu.Unlock()
+
+	n, err := f.ReadAt(p, off)
+
+	f.mu.Lock()
+	f.offset = off + int64(n)
+	f.mu.Unlock()
+
+	//Read读到文件末尾但有数据时不返回EOF
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("fastdfs: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("fastdfs: negative position")
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("fastdfs: negative offset")
+	}
+
+	n := 0
+	for n < len(p) {
+		if off >= f.size {
+			return n, io.EOF
+		}
+
+		nn, err := f.readAt(p[n:], off)
+		n += nn
+		off += int64(nn)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+//读取一段数据，优先从预读缓冲获取
+//需要的数据大于预读大小时直接下载到p
+func (f *File) readAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+
+	if off >= f.bufOff && off < f.bufOff+int64(len(f.buf)) {
+		return copy(p, f.buf[off-f.bufOff:]), nil
+	}
+
+	want := int64(len(p))
+	if want > f.size-off {
+		want = f.size - off
+	}
+
+	if want >= int64(f.c.opt.ReadAheadSize) {
+		return f.download(p[:want], off)
+	}
+
+	size := int64(f.c.opt.ReadAheadSize)
+	if size > f.size-off {
+		size = f.size - off
+	}
+	if int64(cap(f.buf)) < size {
+		f.buf = make([]byte, size)
+	}
+
+	nr, err := f.download(f.buf[:size], off)
+	f.buf = f.buf[:nr]
+	f.bufOff = off
+	if err != nil {
+		return 0, err
+	}
+
+	return copy(p, f.buf), nil
+}
+
+//从存储下载[off, off+len(b))到b
+func (f *File) download(b []byte, off int64) (int, error) {
+	w := &sliceWriter{b: b}
+	n, err := f.c.downloadRetry(f.storage, w, off, int64(len(b)), nil)
+	if err != nil {
+		return n, err
+	}
+	if n != len(b) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrFileClosed
+	}
+	f.closed = true
+	f.buf = nil
+	return nil
+}
+
+//写入固定大小[]byte的writer
+type sliceWriter struct {
+	b []byte
+	n int
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	n := copy(w.b[w.n:], p)
+	w.n += n
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
@@ -0,0 +1,114 @@
+package go_fastdfs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func openTestFile(t *testing.T, size, readAhead int) (*File, *fakeStorage, []byte) {
+	name := fakeRemoteName(".bin")
+	data := fakeData(size)
+	srv := newFakeStorage(t, map[string][]byte{name: data})
+
+	c := NewClient(&Options{Addr: srv.addr(), ReadAheadSize: readAhead})
+	t.Cleanup(func() { c.Close() })
+
+	f, err := c.OpenFile("group1/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Size() != int64(size) {
+		t.Fatalf("Size() = %d, want %d", f.Size(), size)
+	}
+	return f, srv, data
+}
+
+func TestFileReader(t *testing.T) {
+	f, _, data := openTestFile(t, 100*1024+13, 1000)
+	defer f.Close()
+
+	if err := iotest.TestReader(f, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//小的顺序读取从预读缓冲获取，大于预读大小的读取直接下载
+func TestFileReadAhead(t *testing.T) {
+	f, srv, data := openTestFile(t, 10000, 1000)
+	defer f.Close()
+
+	p := make([]byte, 100)
+	for off := 0; off < 3000; off += len(p) {
+		if _, err := io.ReadFull(f, p); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p, data[off:off+len(p)]) {
+			t.Fatalf("data mismatch at %d", off)
+		}
+	}
+	if n := srv.downloadCount(); n != 3 {
+		t.Fatalf("downloads = %d, want 3", n)
+	}
+
+	big := make([]byte, 5000)
+	if _, err := f.ReadAt(big, 4000); err != nil || !bytes.Equal(big, data[4000:9000]) {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if n := srv.downloadCount(); n != 4 {
+		t.Fatalf("downloads = %d, want 4", n)
+	}
+}
+
+func TestFileEOF(t *testing.T) {
+	f, _, data := openTestFile(t, 10000, 1000)
+	defer f.Close()
+
+	//跨过文件末尾的ReadAt返回已读部分和io.EOF
+	p := make([]byte, 100)
+	n, err := f.ReadAt(p, 9950)
+	if n != 50 || err != io.EOF || !bytes.Equal(p[:n], data[9950:]) {
+		t.Fatalf("ReadAt = %d, %v", n, err)
+	}
+	if n, err := f.ReadAt(p, 10000); n != 0 || err != io.EOF {
+		t.Fatalf("ReadAt at end = %d, %v", n, err)
+	}
+
+	//Read读到末尾时先返回数据，下一次返回io.EOF
+	if _, err := f.Seek(-30, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	n, err = f.Read(p)
+	if n != 30 || err != nil || !bytes.Equal(p[:n], data[9970:]) {
+		t.Fatalf("Read = %d, %v", n, err)
+	}
+	if n, err := f.Read(p); n != 0 || err != io.EOF {
+		t.Fatalf("Read at end = %d, %v", n, err)
+	}
+
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("negative position accepted")
+	}
+	if _, err := f.ReadAt(p, -1); err == nil {
+		t.Fatal("negative offset accepted")
+	}
+
+	f.Close()
+	if _, err := f.Read(p); err != ErrFileClosed {
+		t.Fatalf("Read after Close = %v", err)
+	}
+}
+
+func TestFileEmpty(t *testing.T) {
+	f, srv, _ := openTestFile(t, 0, 1000)
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil || len(b) != 0 {
+		t.Fatalf("ReadAll = %d, %v", len(b), err)
+	}
+	if n := srv.downloadCount(); n != 0 {
+		t.Fatalf("downloads = %d, want 0", n)
+	}
+}
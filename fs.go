@@ -0,0 +1,87 @@
+package go_fastdfs
+
+import (
+	"io/fs"
+	"path"
+	"time"
+)
+
+//以fileid(group/M00/xx/yy/name)为路径的fs.FS
+//只支持文件，不支持目录的读取
+//Open和Stat都会向存储确认文件存在，不存在时返回fs.ErrNotExist
+type FS struct {
+	c *FastdfsClient
+}
+
+var (
+	_ fs.FS     = (*FS)(nil)
+	_ fs.StatFS = (*FS)(nil)
+	_ fs.File   = (*File)(nil)
+)
+
+//返回以当前client为后端的fs.FS
+func (c *FastdfsClient) FS() *FS {
+	return &FS{c: c}
+}
+
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if err := checkFsPath(name); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	f, err := fsys.c.openFile(name, true)
+	if err == ErrFileNotFound {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	if err := checkFsPath(name); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	info, err := fsys.c.Stat(name, StatStorage)
+	if err == ErrFileNotFound {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return &fileStat{
+		name:    path.Base(name),
+		size:    info.FileSize,
+		modTime: info.CreateTime,
+		info:    info,
+	}, nil
+}
+
+//路径必须是有效的fs路径，并且包含group和文件名
+func checkFsPath(name string) error {
+	if !fs.ValidPath(name) {
+		return fs.ErrInvalid
+	}
+	if _, _, err := splitFileid(name); err != nil {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+//由FileInfo转换的fs.FileInfo
+type fileStat struct {
+	name    string
+	size    int64
+	modTime time.Time
+	info    *FileInfo
+}
+
+func (s *fileStat) Name() string       { return s.name }
+func (s *fileStat) Size() int64        { return s.size }
+func (s *fileStat) Mode() fs.FileMode  { return 0444 }
+func (s *fileStat) ModTime() time.Time { return s.modTime }
+func (s *fileStat) IsDir() bool        { return false }
+func (s *fileStat) Sys() interface{}   { return s.info }
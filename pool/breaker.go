@@ -0,0 +1,117 @@
+package pool
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("fastdfs: circuit breaker is open")
+
+//熔断器状态
+type BreakerState uint32
+
+const (
+	BreakerClosed   BreakerState = iota //正常放行
+	BreakerOpen                         //连续失败后快速失败
+	BreakerHalfOpen                     //冷却结束，放行一个探测请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+//连接池的熔断器
+//连续失败threshold次后打开，cooldown后半开放行一个探测请求
+//探测成功则关闭，失败则重新打开
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probedAt time.Time
+
+	opens   uint32
+	rejects uint32
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+//是否放行一个请求
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			b.rejects++
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probedAt = time.Now()
+		return true
+	case BreakerHalfOpen:
+		//探测请求没有结果时，超过cooldown再放行一个
+		if time.Since(b.probedAt) < b.cooldown {
+			b.rejects++
+			return false
+		}
+		b.probedAt = time.Now()
+		return true
+	}
+	return true
+}
+
+func (b *breaker) success() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.failures = 0
+	b.state = BreakerClosed
+	b.mu.Unlock()
+}
+
+func (b *breaker) failure() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		b.opens++
+	}
+	b.mu.Unlock()
+}
+
+func (b *breaker) stats() (state BreakerState, opens, rejects uint32) {
+	b.mu.Lock()
+	state, opens, rejects = b.state, b.opens, b.rejects
+	b.mu.Unlock()
+	return
+}
@@ -0,0 +1,121 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+
+	type step struct {
+		op    string //allow、success、failure、wait
+		allow bool   //op为allow时的期望结果
+		state BreakerState
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"closed until threshold", []step{
+			{op: "failure", state: BreakerClosed},
+			{op: "allow", allow: true, state: BreakerClosed},
+			{op: "failure", state: BreakerClosed},
+			{op: "failure", state: BreakerOpen},
+			{op: "allow", allow: false, state: BreakerOpen},
+		}},
+		{"success resets failures", []step{
+			{op: "failure", state: BreakerClosed},
+			{op: "failure", state: BreakerClosed},
+			{op: "success", state: BreakerClosed},
+			{op: "failure", state: BreakerClosed},
+			{op: "failure", state: BreakerClosed},
+			{op: "allow", allow: true, state: BreakerClosed},
+		}},
+		{"half-open probe succeeds", []step{
+			{op: "failure", state: BreakerClosed},
+			{op: "failure", state: BreakerClosed},
+			{op: "failure", state: BreakerOpen},
+			{op: "wait", state: BreakerOpen},
+			{op: "allow", allow: true, state: BreakerHalfOpen},
+			{op: "allow", allow: false, state: BreakerHalfOpen},
+			{op: "success", state: BreakerClosed},
+			{op: "allow", allow: true, state: BreakerClosed},
+		}},
+		{"half-open probe fails", []step{
+			{op: "failure", state: BreakerClosed},
+			{op: "failure", state: BreakerClosed},
+			{op: "failure", state: BreakerOpen},
+			{op: "wait", state: BreakerOpen},
+			{op: "allow", allow: true, state: BreakerHalfOpen},
+			{op: "failure", state: BreakerOpen},
+			{op: "allow", allow: false, state: BreakerOpen},
+		}},
+		{"half-open probe without result", []step{
+			{op: "failure", state: BreakerClosed},
+			{op: "failure", state: BreakerClosed},
+			{op: "failure", state: BreakerOpen},
+			{op: "wait", state: BreakerOpen},
+			{op: "allow", allow: true, state: BreakerHalfOpen},
+			{op: "allow", allow: false, state: BreakerHalfOpen},
+			{op: "wait", state: BreakerHalfOpen},
+			{op: "allow", allow: true, state: BreakerHalfOpen},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker(3, cooldown)
+			for i, s := range tt.steps {
+				switch s.op {
+				case "allow":
+					if got := b.allow(); got != s.allow {
+						t.Fatalf("step %d: allow() = %v, want %v", i, got, s.allow)
+					}
+				case "success":
+					b.success()
+				case "failure":
+					b.failure()
+				case "wait":
+					time.Sleep(cooldown + 5*time.Millisecond)
+				}
+				if state, _, _ := b.stats(); state != s.state {
+					t.Fatalf("step %d: state = %v, want %v", i, state, s.state)
+				}
+			}
+		})
+	}
+}
+
+//threshold为0时不启用
+func TestBreakerDisabled(t *testing.T) {
+	b := newBreaker(0, time.Second)
+	for i := 0; i < 10; i++ {
+		b.failure()
+	}
+	if !b.allow() {
+		t.Fatal("disabled breaker rejected")
+	}
+	if state, opens, _ := b.stats(); state != BreakerClosed || opens != 0 {
+		t.Fatalf("state = %v, opens = %d", state, opens)
+	}
+}
+
+func TestBreakerStats(t *testing.T) {
+	p, _ := newPipePool(&Options{BreakerThreshold: 2, BreakerCooldown: time.Minute})
+	defer p.Close()
+
+	p.ReportFailure()
+	p.ReportFailure()
+	for i := 0; i < 3; i++ {
+		if _, _, err := p.Get(); err != ErrCircuitOpen {
+			t.Fatalf("Get() = %v, want ErrCircuitOpen", err)
+		}
+	}
+
+	st := p.Stats()
+	if st.BreakerState != BreakerOpen || st.BreakerOpens != 1 || st.BreakerRejects != 3 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
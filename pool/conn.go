@@ -1,26 +1,54 @@
 package pool
 
 import (
+	"errors"
 	"net"
 	"sync/atomic"
 	"time"
 )
 
+var errUnexpectedRead = errors.New("fastdfs: unexpected read from connection")
+
 type Conn struct {
 	net.Conn
-	usedAt atomic.Value
-	Reader *Reader
+	usedAt    atomic.Value
+	createdAt time.Time
+	useCount  uint32 // atomic，被Get取出的次数
+	Reader    *Reader
 }
 
 func NewConn(netConn net.Conn) *Conn {
+	now := time.Now()
 	cn := &Conn{
-		Conn:   netConn,
-		Reader: NewReader(netConn),
+		Conn:      netConn,
+		Reader:    NewReader(netConn),
+		createdAt: now,
 	}
-	cn.SetUsedAt(time.Now())
+	cn.SetUsedAt(now)
 	return cn
 }
 
+func (cn *Conn) CreatedAt() time.Time {
+	return cn.createdAt
+}
+
+func (cn *Conn) UseCount() uint32 {
+	return atomic.LoadUint32(&cn.useCount)
+}
+
+func (cn *Conn) incrUseCount() {
+	atomic.AddUint32(&cn.useCount, 1)
+}
+
+//连接是否超过了最大存活时间或者最大使用次数
+//maxAge和maxRequests为0时不限制
+func (cn *Conn) IsExpired(maxAge time.Duration, maxRequests int) bool {
+	if maxAge > 0 && time.Since(cn.createdAt) > maxAge {
+		return true
+	}
+	return maxRequests > 0 && cn.UseCount() >= uint32(maxRequests)
+}
+
 func (cn *Conn) IsStale(timeout time.Duration) bool {
 	return timeout > 0 && time.Since(cn.UsedAt()) > timeout
 }
@@ -32,3 +60,28 @@ func (cn *Conn) UsedAt() time.Time {
 func (cn *Conn) SetUsedAt(tm time.Time) {
 	cn.usedAt.Store(tm)
 }
+
+//不阻塞地检测连接是否干净
+//读缓冲中有残留数据、对端已关闭或者socket上有未读的数据时返回错误
+func (cn *Conn) CheckPure() error {
+	if len(cn.Reader.PeekBuffered()) > 0 {
+		return errUnexpectedRead
+	}
+	return connCheck(cn.Conn)
+}
+
+//设置从现在起的读超时，timeout<=0时取消读超时
+func (cn *Conn) SetReadTimeout(timeout time.Duration) error {
+	if timeout > 0 {
+		return cn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	return cn.SetReadDeadline(time.Time{})
+}
+
+//设置从现在起的写超时，timeout<=0时取消写超时
+func (cn *Conn) SetWriteTimeout(timeout time.Duration) error {
+	if timeout > 0 {
+		return cn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	return cn.SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,69 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd || solaris || illumos
+// +build linux darwin dragonfly freebsd netbsd openbsd solaris illumos
+
+package pool
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func dialPair(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func TestConnCheck(t *testing.T) {
+	client, server := dialPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	if err := connCheck(client); err != nil {
+		t.Fatalf("clean conn: %v", err)
+	}
+
+	server.Write([]byte{1})
+	time.Sleep(50 * time.Millisecond)
+	if err := connCheck(client); err != errUnexpectedRead {
+		t.Fatalf("conn with data: %v", err)
+	}
+
+	server.Close()
+	time.Sleep(50 * time.Millisecond)
+	if err := connCheck(client); err != io.EOF {
+		t.Fatalf("closed conn: %v", err)
+	}
+}
+
+func TestConnCheckPure(t *testing.T) {
+	client, server := dialPair(t)
+	defer server.Close()
+
+	cn := NewConn(client)
+	defer cn.Close()
+
+	server.Write([]byte{1, 2})
+	b, err := cn.Reader.ReadN(1)
+	if err != nil || b[0] != 1 {
+		t.Fatal(b, err)
+	}
+	//第二个字节留在读缓冲中
+	if err := cn.CheckPure(); err != errUnexpectedRead {
+		t.Fatalf("buffered data: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"net"
 	"sync"
@@ -24,8 +25,13 @@ type Stats struct {
 	Misses   uint32 //没有命中连接池连接次数
 	Timeouts uint32 //等待连接池时超时次数
 
-	PoolConns  uint32 //连接池中连接数量
-	StaleConns uint32 //删除连接池中过期连接的次数
+	PoolConns    uint32 //连接池中连接数量
+	StaleConns   uint32 //删除连接池中过期连接的次数
+	ExpiredConns uint32 //超过MaxConnAge或MaxRequestsPerConn而关闭的连接数
+
+	BreakerState   BreakerState //熔断器当前状态
+	BreakerOpens   uint32       //熔断器打开的次数
+	BreakerRejects uint32       //熔断器打开时拒绝的请求数
 }
 
 type Pooler interface {
@@ -46,9 +52,16 @@ type Options struct {
 	Dialer func() (net.Conn, error)
 
 	PoolSize           int
+	MinIdleConns       int //连接池保持的最少空闲连接数
 	PoolTimeout        time.Duration
 	IdleTimeout        time.Duration
 	IdleCheckFrequency time.Duration
+
+	MaxConnAge         time.Duration //连接从创建起的最大存活时间，0不限制
+	MaxRequestsPerConn int           //每个连接最多被取出使用的次数，0不限制
+
+	BreakerThreshold int           //连续失败多少次后打开熔断器，0不启用
+	BreakerCooldown  time.Duration //熔断器打开后多久放行探测请求
 }
 
 type ConnPool struct {
@@ -64,8 +77,10 @@ type ConnPool struct {
 	connsMu sync.Mutex
 	conns   []*Conn
 
-	stats Stats
+	stats   Stats
+	breaker *breaker
 
+	filling uint32 // atomic，是否正在后台补充空闲连接
 	_closed uint32 // atomic
 }
 
@@ -77,13 +92,97 @@ func NewConnPool(opt *Options) *ConnPool {
 
 		queue: make(chan struct{}, opt.PoolSize),
 		conns: make([]*Conn, 0, opt.PoolSize),
+
+		breaker: newBreaker(opt.BreakerThreshold, opt.BreakerCooldown),
 	}
+	p.checkMinIdleConns()
 	if opt.IdleTimeout > 0 && opt.IdleCheckFrequency > 0 {
 		go p.reaper(opt.IdleCheckFrequency)
 	}
 	return p
 }
 
+//空闲连接少于MinIdleConns时，在后台补充
+//同一时间只有一个补充的goroutine
+func (p *ConnPool) checkMinIdleConns() {
+	if p.opt.MinIdleConns <= 0 {
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&p.filling, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreUint32(&p.filling, 0)
+		for p.needIdleConn() {
+			if err := p.addIdleConn(); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+//是否需要补充空闲连接
+//空闲连接和正在使用的连接总数不超过PoolSize
+func (p *ConnPool) needIdleConn() bool {
+	p.connsMu.Lock()
+	need := p.needIdleConnLocked()
+	p.connsMu.Unlock()
+	return need
+}
+
+//调用方connsMu.Lock
+func (p *ConnPool) needIdleConnLocked() bool {
+	if p.closed() {
+		return false
+	}
+	idle := len(p.conns)
+	return idle < p.opt.MinIdleConns && idle+len(p.queue) < p.opt.PoolSize
+}
+
+//创建一个连接放入空闲连接
+//并发补充时已经足够则关闭新建的连接
+func (p *ConnPool) addIdleConn() error {
+	cn, err := p.NewConn()
+	if err != nil {
+		return err
+	}
+
+	p.connsMu.Lock()
+	if p.closed() || !p.needIdleConnLocked() {
+		p.connsMu.Unlock()
+		return p.closeConn(cn)
+	}
+	p.conns = append(p.conns, cn)
+	p.connsMu.Unlock()
+	return nil
+}
+
+//预先创建连接直到空闲连接达到MinIdleConns
+//Dialer不接收ctx，ctx取消时立即返回，正在进行的dial在后台完成后放入空闲连接
+func (p *ConnPool) Warmup(ctx context.Context) error {
+	for p.needIdleConn() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- p.addIdleConn()
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
 //创建一个新的连接
 func (p *ConnPool) NewConn() (*Conn, error) {
 	if p.closed() {
@@ -97,6 +196,7 @@ func (p *ConnPool) NewConn() (*Conn, error) {
 
 	netConn, err := p.opt.Dialer()
 	if err != nil {
+		p.breaker.failure()
 		p.setLastDialError(err)
 		if atomic.AddUint32(&p.dialErrorsNum, 1) == uint32(p.opt.PoolSize) {
 			go p.tryDial()
@@ -149,6 +249,10 @@ func (p *ConnPool) Get() (*Conn, bool, error) {
 		return nil, false, ErrClosed
 	}
 
+	if !p.breaker.allow() {
+		return nil, false, ErrCircuitOpen
+	}
+
 	select {
 	case p.queue <- struct{}{}:
 	default:
@@ -183,7 +287,15 @@ func (p *ConnPool) Get() (*Conn, bool, error) {
 			continue
 		}
 
+		if p.isExpired(cn) {
+			atomic.AddUint32(&p.stats.ExpiredConns, 1)
+			p.closeConn(cn)
+			continue
+		}
+
+		cn.incrUseCount()
 		atomic.AddUint32(&p.stats.Hits, 1)
+		p.checkMinIdleConns()
 		return cn, false, nil
 	}
 
@@ -195,6 +307,7 @@ func (p *ConnPool) Get() (*Conn, bool, error) {
 		return nil, false, err
 	}
 
+	newcn.incrUseCount()
 	return newcn, true, nil
 }
 
@@ -213,17 +326,44 @@ func (p *ConnPool) popDial() *Conn {
 
 //放入连接
 func (p *ConnPool) Put(cn *Conn) error {
+	//超过存活时间或使用次数的连接不再放回
+	if p.isExpired(cn) {
+		p.breaker.success()
+		atomic.AddUint32(&p.stats.ExpiredConns, 1)
+		return p.Remove(cn)
+	}
+
+	p.breaker.success()
+
+	cn.SetUsedAt(time.Now())
 	p.connsMu.Lock()
+	//连接池已关闭时直接关闭连接，Close设置标记后才清空conns，这里不会漏掉
+	if p.closed() {
+		p.connsMu.Unlock()
+		<-p.queue
+		return p.closeConn(cn)
+	}
 	p.conns = append(p.conns, cn)
 	p.connsMu.Unlock()
 	<-p.queue
 	return nil
 }
 
+//报告一次使用连接时的失败，计入熔断器
+//放回连接池(Put)视为一次成功
+func (p *ConnPool) ReportFailure() {
+	p.breaker.failure()
+}
+
+func (p *ConnPool) isExpired(cn *Conn) bool {
+	return cn.IsExpired(p.opt.MaxConnAge, p.opt.MaxRequestsPerConn)
+}
+
 //移除一个连接
 func (p *ConnPool) Remove(cn *Conn) error {
 	_ = p.CloseConn(cn)
 	<-p.queue
+	p.checkMinIdleConns()
 	return nil
 }
 
@@ -235,15 +375,26 @@ func (p *ConnPool) Len() int {
 	return l
 }
 
+//返回正在使用中的连接数
+func (p *ConnPool) InUse() int {
+	return len(p.queue)
+}
+
 //获取当前的统计值
 func (p *ConnPool) Stats() *Stats {
+	state, opens, rejects := p.breaker.stats()
 	return &Stats{
 		Hits:     atomic.LoadUint32(&p.stats.Hits),
 		Misses:   atomic.LoadUint32(&p.stats.Misses),
 		Timeouts: atomic.LoadUint32(&p.stats.Timeouts),
 
-		PoolConns:  uint32(p.Len()),
-		StaleConns: atomic.LoadUint32(&p.stats.StaleConns),
+		PoolConns:    uint32(p.Len()),
+		StaleConns:   atomic.LoadUint32(&p.stats.StaleConns),
+		ExpiredConns: atomic.LoadUint32(&p.stats.ExpiredConns),
+
+		BreakerState:   state,
+		BreakerOpens:   opens,
+		BreakerRejects: rejects,
 	}
 }
 
@@ -307,10 +458,36 @@ func (p *ConnPool) reapStaleConn() bool {
 	return true
 }
 
+//关闭连接池中超过MaxConnAge的空闲连接
+//调用方mu.Lock
+func (p *ConnPool) reapExpiredConns() int {
+	if p.opt.MaxConnAge <= 0 {
+		return 0
+	}
+
+	var n int
+	conns := p.conns[:0]
+	for _, cn := range p.conns {
+		if p.isExpired(cn) {
+			p.closeConn(cn)
+			n++
+			continue
+		}
+		conns = append(conns, cn)
+	}
+	p.conns = conns
+	return n
+}
+
+//连接池占满时不等待，本轮跳过回收，避免阻塞共用的reaper
 func (p *ConnPool) ReapStaleConns() (int, error) {
 	var n int
 	for {
-		p.queue <- struct{}{}
+		select {
+		case p.queue <- struct{}{}:
+		default:
+			return n, nil
+		}
 		p.connsMu.Lock()
 
 		reaped := p.reapStaleConn()
@@ -327,6 +504,27 @@ func (p *ConnPool) ReapStaleConns() (int, error) {
 	return n, nil
 }
 
+//回收过期和超龄的空闲连接，并补充空闲连接
+//IdleCheckFrequency为0时连接池不启动reaper，由调用方定时调用
+func (p *ConnPool) Reap() {
+	if p.closed() {
+		return
+	}
+
+	n, err := p.ReapStaleConns()
+	if err != nil {
+		return
+	}
+	atomic.AddUint32(&p.stats.StaleConns, uint32(n))
+
+	p.connsMu.Lock()
+	n = p.reapExpiredConns()
+	p.connsMu.Unlock()
+	atomic.AddUint32(&p.stats.ExpiredConns, uint32(n))
+
+	p.checkMinIdleConns()
+}
+
 func (p *ConnPool) reaper(frequency time.Duration) {
 	ticker := time.NewTicker(frequency)
 	defer ticker.Stop()
@@ -335,10 +533,6 @@ func (p *ConnPool) reaper(frequency time.Duration) {
 		if p.closed() {
 			break
 		}
-		n, err := p.ReapStaleConns()
-		if err != nil {
-			continue
-		}
-		atomic.AddUint32(&p.stats.StaleConns, uint32(n))
+		p.Reap()
 	}
 }
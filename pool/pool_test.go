@@ -0,0 +1,47 @@
+package pool
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func newPipePool(opt *Options) (*ConnPool, *[]net.Conn) {
+	var servers []net.Conn
+	opt.Dialer = func() (net.Conn, error) {
+		client, server := net.Pipe()
+		servers = append(servers, server)
+		return client, nil
+	}
+	if opt.PoolSize == 0 {
+		opt.PoolSize = 2
+	}
+	if opt.PoolTimeout == 0 {
+		opt.PoolTimeout = time.Second
+	}
+	return NewConnPool(opt), &servers
+}
+
+//连接池关闭后放回的连接要被关闭，不能留在conns中
+func TestPutAfterClose(t *testing.T) {
+	p, servers := newPipePool(&Options{})
+
+	cn, _, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p.Put(cn)
+
+	if p.Len() != 0 || p.InUse() != 0 {
+		t.Fatalf("len=%d inuse=%d", p.Len(), p.InUse())
+	}
+	//对端读到EOF说明连接已关闭
+	(*servers)[0].SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := (*servers)[0].Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("conn was not closed: %v", err)
+	}
+}
@@ -12,13 +12,20 @@ const (
 	TRACKER_PROTO_CMD_SERVICE_QUERY_STORE_WITHOUT_GROUP_ONE = 101
 	TRACKER_PROTO_CMD_SERVICE_QUERY_FETCH_ONE               = 102
 	TRACKER_PROTO_CMD_SERVICE_QUERY_UPDATE                  = 103
+	TRACKER_PROTO_CMD_SERVICE_QUERY_FETCH_ALL               = 105
 
 	STORAGE_PROTO_CMD_QUERY_FILE_INFO = 22
 	STORAGE_PROTO_CMD_RESP            = TRACKER_PROTO_CMD_RESP
 	STORAGE_PROTO_CMD_DOWNLOAD_FILE   = 14
+	STORAGE_PROTO_CMD_DELETE_FILE     = 12
 
 	FDFS_PROTO_CMD_ACTIVE_TEST = 111
 
+	FDFS_QUERY_FINFO_FLAGS_NOT_CALC_CRC32 = 1
+	FDFS_QUERY_FINFO_FLAGS_KEEP_SILENCE   = 2
+
+	FDFS_ERR_ENOENT = 2
+
 	FDFS_GROUP_NAME_MAX_LEN = 16
 	FDFS_IPADDR_SIZE        = 16
 	FDFS_PROTO_PKG_LEN_SIZE = 8
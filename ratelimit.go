@@ -0,0 +1,161 @@
+package go_fastdfs
+
+import (
+	"sync"
+	"time"
+)
+
+//请求数和传输字节数的限制，0不限制
+//只限制发往storage的下载和查询请求，tracker查询不计入
+type RateLimit struct {
+	RequestsPerSecond float64
+	BytesPerSecond    int64
+}
+
+//令牌桶，允许透支，透支的部分通过等待偿还
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 //每秒产生的令牌数，<=0不限制
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) setRate(rate, burst float64) {
+	b.mu.Lock()
+	b.rate = rate
+	b.burst = burst
+	b.tokens = burst
+	b.last = time.Now()
+	b.mu.Unlock()
+}
+
+//取走n个令牌，令牌不足时等待
+func (b *tokenBucket) wait(n float64) {
+	b.mu.Lock()
+	if b.rate <= 0 {
+		b.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= n
+
+	var d time.Duration
+	if b.tokens < 0 {
+		d = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+type limiter struct {
+	requests tokenBucket
+	bytes    tokenBucket
+	custom   bool //通过SetStorageRateLimit单独设置，连接池淘汰时保留
+}
+
+func newLimiter(l RateLimit) *limiter {
+	lim := &limiter{}
+	lim.set(l)
+	return lim
+}
+
+//突发允许1秒的量
+func (lim *limiter) set(l RateLimit) {
+	burst := l.RequestsPerSecond
+	if burst < 1 {
+		burst = 1
+	}
+	lim.requests.setRate(l.RequestsPerSecond, burst)
+	lim.bytes.setRate(float64(l.BytesPerSecond), float64(l.BytesPerSecond))
+}
+
+//client和每个storage的限流
+type rateLimiters struct {
+	client *limiter
+
+	mu             sync.Mutex
+	storageDefault RateLimit
+	storages       map[string]*limiter
+}
+
+func newRateLimiters(opt *Options) *rateLimiters {
+	return &rateLimiters{
+		client:         newLimiter(opt.RateLimit),
+		storageDefault: opt.StorageRateLimit,
+		storages:       make(map[string]*limiter),
+	}
+}
+
+func (r *rateLimiters) storage(addr string) *limiter {
+	r.mu.Lock()
+	lim, ok := r.storages[addr]
+	if !ok {
+		lim = newLimiter(r.storageDefault)
+		r.storages[addr] = lim
+	}
+	r.mu.Unlock()
+	return lim
+}
+
+//storage的连接池被淘汰时移除其限流，单独设置的保留
+func (r *rateLimiters) remove(addr string) {
+	r.mu.Lock()
+	if lim, ok := r.storages[addr]; ok && !lim.custom {
+		delete(r.storages, addr)
+	}
+	r.mu.Unlock()
+}
+
+//向addr发起一个请求前调用
+func (r *rateLimiters) waitRequest(addr string) {
+	r.client.requests.wait(1)
+	r.storage(addr).requests.wait(1)
+}
+
+//从addr传输n字节后调用
+func (r *rateLimiters) waitBytes(addr string, n int) {
+	r.client.bytes.wait(float64(n))
+	r.storage(addr).bytes.wait(float64(n))
+}
+
+//运行时修改client的总限制
+func (c *FastdfsClient) SetRateLimit(l RateLimit) {
+	c.limits.client.set(l)
+}
+
+//运行时修改单个storage(ip:port)的限制
+func (c *FastdfsClient) SetStorageRateLimit(addr string, l RateLimit) {
+	r := c.limits
+	r.mu.Lock()
+	lim, ok := r.storages[addr]
+	if !ok {
+		lim = newLimiter(l)
+		r.storages[addr] = lim
+	} else {
+		lim.set(l)
+	}
+	lim.custom = true
+	r.mu.Unlock()
+}
+
+//运行时修改所有storage的默认限制，已有单独设置的storage也会被覆盖
+func (c *FastdfsClient) SetDefaultStorageRateLimit(l RateLimit) {
+	r := c.limits
+	r.mu.Lock()
+	r.storageDefault = l
+	for _, lim := range r.storages {
+		lim.set(l)
+		lim.custom = false
+	}
+	r.mu.Unlock()
+}
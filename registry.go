@@ -0,0 +1,187 @@
+package go_fastdfs
+
+import (
+	"errors"
+	"github.com/monkey92t/go_fastdfs/pool"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrTooManyStoragePools = errors.New("fastdfs: too many storage pools")
+
+//storage的地址和对应连接池的统计
+type StorageEndpoint struct {
+	Addr     string
+	LastUsed time.Time
+	Stats    *pool.Stats
+}
+
+type storeEntry struct {
+	pool     *pool.ConnPool
+	lastUsed time.Time
+}
+
+//storage连接池的注册表
+//限制连接池的数量，淘汰长时间未使用的连接池
+//并由一个goroutine统一回收所有连接池的空闲连接
+type storeRegistry struct {
+	c *FastdfsClient
+
+	mu      sync.Mutex
+	entries map[string]*storeEntry
+
+	done chan struct{}
+}
+
+func newStoreRegistry(c *FastdfsClient) *storeRegistry {
+	r := &storeRegistry{
+		c:       c,
+		entries: make(map[string]*storeEntry),
+		done:    make(chan struct{}),
+	}
+	if c.opt.IdleCheckFrequency > 0 {
+		go r.reaper(c.opt.IdleCheckFrequency)
+	}
+	return r
+}
+
+//获取addr的连接池，没有则创建
+//达到MaxStoragePools时淘汰最久未使用且没有使用中连接的连接池
+func (r *storeRegistry) get(addr string) (*pool.ConnPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.entries == nil {
+		return nil, pool.ErrClosed
+	}
+
+	e, ok := r.entries[addr]
+	if !ok {
+		if r.c.opt.MaxStoragePools > 0 && len(r.entries) >= r.c.opt.MaxStoragePools {
+			if !r.evictOldest() {
+				return nil, ErrTooManyStoragePools
+			}
+		}
+
+		poolOpt := r.c.getPoolOpt()
+		poolOpt.Dialer = defaultDialer(r.c.opt, addr)
+		e = &storeEntry{pool: pool.NewConnPool(poolOpt)}
+		r.entries[addr] = e
+	}
+	e.lastUsed = time.Now()
+
+	return e.pool, nil
+}
+
+//淘汰最久未使用且空闲的连接池
+//调用方mu.Lock
+func (r *storeRegistry) evictOldest() bool {
+	var oldest string
+	var oldestEntry *storeEntry
+	for addr, e := range r.entries {
+		if e.pool.InUse() > 0 {
+			continue
+		}
+		if oldestEntry == nil || e.lastUsed.Before(oldestEntry.lastUsed) {
+			oldest, oldestEntry = addr, e
+		}
+	}
+	if oldestEntry == nil {
+		return false
+	}
+
+	delete(r.entries, oldest)
+	r.c.limits.remove(oldest)
+	_ = oldestEntry.pool.Close()
+	return true
+}
+
+//淘汰超过StoragePoolIdleTimeout未使用的连接池
+func (r *storeRegistry) evictIdle() {
+	timeout := r.c.opt.StoragePoolIdleTimeout
+	if timeout <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for addr, e := range r.entries {
+		if time.Since(e.lastUsed) > timeout && e.pool.InUse() == 0 {
+			delete(r.entries, addr)
+			r.c.limits.remove(addr)
+			_ = e.pool.Close()
+		}
+	}
+}
+
+//当前所有的连接池
+func (r *storeRegistry) pools() []*pool.ConnPool {
+	r.mu.Lock()
+	pools := make([]*pool.ConnPool, 0, len(r.entries))
+	for _, e := range r.entries {
+		pools = append(pools, e.pool)
+	}
+	r.mu.Unlock()
+	return pools
+}
+
+//当前所有的storage地址和统计，按地址排序
+func (r *storeRegistry) endpoints() []StorageEndpoint {
+	r.mu.Lock()
+	eps := make([]StorageEndpoint, 0, len(r.entries))
+	for addr, e := range r.entries {
+		eps = append(eps, StorageEndpoint{
+			Addr:     addr,
+			LastUsed: e.lastUsed,
+			Stats:    e.pool.Stats(),
+		})
+	}
+	r.mu.Unlock()
+
+	sort.Slice(eps, func(i, j int) bool {
+		return eps[i].Addr < eps[j].Addr
+	})
+	return eps
+}
+
+//统一回收tracker和所有storage连接池的空闲连接
+func (r *storeRegistry) reaper(frequency time.Duration) {
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.done:
+			return
+		}
+
+		r.evictIdle()
+		r.c.connPool.Reap()
+		for _, p := range r.pools() {
+			p.Reap()
+		}
+	}
+}
+
+//关闭所有连接池
+func (r *storeRegistry) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.entries == nil {
+		return pool.ErrClosed
+	}
+
+	close(r.done)
+	var firstErr error
+	for _, e := range r.entries {
+		if err := e.pool.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	r.entries = nil
+	return firstErr
+}
@@ -0,0 +1,123 @@
+package go_fastdfs
+
+import (
+	"context"
+	"sync"
+)
+
+//单个storage上副本的查询结果
+type ReplicaStatus struct {
+	Addr string
+	Info *FileInfo
+	Err  error
+}
+
+//文件在组内所有storage上的副本检查结果
+type ReplicaReport struct {
+	Fileid   string
+	Expected *FileInfo //用于比较的大小和crc32，来自文件名或第一个查询到的副本
+	Replicas []ReplicaStatus
+
+	Missing    []string //文件不存在的storage
+	Mismatched []string //大小或crc32不一致的storage
+	Failed     []string //查询失败，无法确认的storage
+}
+
+//所有storage都有一致的副本
+func (r *ReplicaReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Mismatched) == 0 && len(r.Failed) == 0
+}
+
+//检查文件在组内所有storage上的副本
+//通过QUERY_FETCH_ALL获取组内的storage，逐个查询文件信息，
+//找出缺失的副本和大小、crc32不一致的副本
+func (c *FastdfsClient) VerifyReplicas(fileid string) (*ReplicaReport, error) {
+	groupName, remoteName, err := splitFileid(fileid)
+	if err != nil {
+		return nil, err
+	}
+
+	storages, err := c.queryStorages(groupName, remoteName, TRACKER_PROTO_CMD_SERVICE_QUERY_FETCH_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReplicaReport{
+		Fileid:   fileid,
+		Replicas: make([]ReplicaStatus, len(storages)),
+	}
+
+	var wg sync.WaitGroup
+	for i, storage := range storages {
+		wg.Add(1)
+		go func(i int, storage *Storage) {
+			defer wg.Done()
+			info, err := storage.queryFileInfo(0)
+			report.Replicas[i] = ReplicaStatus{Addr: storage.addr, Info: info, Err: err}
+		}(i, storage)
+	}
+	wg.Wait()
+
+	//能从文件名解析出大小时以文件名记录的为准，
+	//大小未知(FileSize为-1)时以第一个查询到的副本为准
+	if info, _ := c.decodeFileInfo(remoteName); info != nil && info.FileSize >= 0 {
+		report.Expected = info
+	}
+	for _, r := range report.Replicas {
+		switch {
+		case r.Err == ErrFileNotFound:
+			report.Missing = append(report.Missing, r.Addr)
+		case r.Err != nil:
+			report.Failed = append(report.Failed, r.Addr)
+		case report.Expected == nil:
+			report.Expected = r.Info
+		case r.Info.FileSize != report.Expected.FileSize ||
+			uint32(r.Info.Crc32) != uint32(report.Expected.Crc32):
+			report.Mismatched = append(report.Mismatched, r.Addr)
+		}
+	}
+
+	return report, nil
+}
+
+//批量检查副本，用于审计
+//从fileids读取直到关闭或者ctx取消，最多concurrency个文件同时检查，
+//每个文件的结果调用fn，fn会被并发调用；tracker查询失败的文件以err传给fn
+func (c *FastdfsClient) ScanReplicas(ctx context.Context, fileids <-chan string, concurrency int, fn func(fileid string, report *ReplicaReport, err error)) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		var fileid string
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case fileid, ok = <-fileids:
+			if !ok {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(fileid string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			report, err := c.VerifyReplicas(fileid)
+			fn(fileid, report, err)
+		}(fileid)
+	}
+}
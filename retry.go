@@ -0,0 +1,111 @@
+package go_fastdfs
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+//幂等操作(查询storage、查询文件信息、未写入数据的下载)的重试策略
+type RetryPolicy struct {
+	MaxAttempts int           //最多尝试的次数，包括第一次，<=1不重试
+	MinBackoff  time.Duration //第一次重试前的等待时间，默认100ms
+	MaxBackoff  time.Duration //重试等待时间的上限，默认2s
+
+	//判断错误是否可以重试，为nil时使用IsRetryableError
+	Retryable func(error) bool
+}
+
+//第attempt次重试前的等待时间
+//按指数增长，并在[d/2, d)之间随机
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	min, max := p.MinBackoff, p.MaxBackoff
+	if min <= 0 {
+		min = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 2 * time.Second
+	}
+
+	d := min
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryableError(err)
+}
+
+//默认的可重试错误：连接被关闭、重置、拒绝或者网络超时
+func IsRetryableError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+//不再重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+//按照Options.RetryPolicy执行fn
+//fn返回*permanentError时不再重试
+func (c *FastdfsClient) withRetry(fn func() error) error {
+	p := c.opt.RetryPolicy
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if pe, ok := err.(*permanentError); ok {
+			return pe.err
+		}
+		if p == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+
+		time.Sleep(p.backoff(attempt))
+	}
+}
+
+//下载到w，失败并且还没有写入数据时重试
+func (c *FastdfsClient) downloadRetry(s *Storage, w io.Writer, offset, size int64, verify func() error) (int, error) {
+	var n int
+	err := c.withRetry(func() error {
+		var err error
+		n, err = s.downloadToWrite(w, offset, size, verify)
+		if err != nil && n > 0 {
+			return &permanentError{err}
+		}
+		return err
+	})
+	return n, err
+}
@@ -0,0 +1,30 @@
+package go_fastdfs
+
+import (
+	"time"
+)
+
+//查询下载和获取文件信息使用的storage
+//文件创建时间在SyncWindow内时，通过QUERY_UPDATE路由到文件名中记录的源storage，
+//避免访问到还没有同步的副本，源storage不可用时仍由tracker选择
+func (c *FastdfsClient) queryFetchStorage(groupName, remoteName string) (*Storage, error) {
+	if c.opt.SyncWindow > 0 && c.isRecentFile(remoteName) {
+		storage, err := c.queryStorage(groupName, remoteName, TRACKER_PROTO_CMD_SERVICE_QUERY_UPDATE)
+		if err == nil {
+			return storage, nil
+		}
+	}
+
+	return c.queryStorage(groupName, remoteName, TRACKER_PROTO_CMD_SERVICE_QUERY_FETCH_ONE)
+}
+
+//文件是否在SyncWindow内创建
+func (c *FastdfsClient) isRecentFile(remoteName string) bool {
+	deData, err := decodeRemoteName(remoteName)
+	if err != nil {
+		return false
+	}
+
+	ctime := time.Unix(int64(buffToInt32(deData, 4)), 0)
+	return time.Since(ctime) < c.opt.SyncWindow
+}
@@ -0,0 +1,57 @@
+package go_fastdfs
+
+import "errors"
+
+var ErrNeedQuery = errors.New("fastdfs: file info can not be decoded from file id")
+
+//Stat获取文件信息的方式
+type StatMode int
+
+const (
+	//只从文件名解析，不访问存储，无法解析时返回ErrNeedQuery
+	//文件即使已被删除也会返回信息
+	StatLocal StatMode = iota
+	//总是向存储查询，文件不存在时返回ErrFileNotFound
+	StatStorage
+	//向存储查询，不计算appender文件的crc32，存储不记录文件不存在的错误日志
+	StatStorageQuick
+)
+
+//按照mode获取文件信息
+func (c *FastdfsClient) Stat(fileid string, mode StatMode) (*FileInfo, error) {
+	groupName, remoteName, err := splitFileid(fileid)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case StatLocal:
+		info, err := c.decodeFileInfo(remoteName)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil {
+			return nil, ErrNeedQuery
+		}
+		return info, nil
+	case StatStorage:
+		return c.queryFileInfoFlags(groupName, remoteName, 0)
+	case StatStorageQuick:
+		return c.queryFileInfoFlags(groupName, remoteName, FDFS_QUERY_FINFO_FLAGS_NOT_CALC_CRC32|FDFS_QUERY_FINFO_FLAGS_KEEP_SILENCE)
+	}
+
+	return nil, errors.New("fastdfs: unknown stat mode")
+}
+
+//向存储确认文件是否存在
+//文件不存在时返回false和nil，无法确认时返回错误
+func (c *FastdfsClient) Exists(fileid string) (bool, error) {
+	_, err := c.Stat(fileid, StatStorageQuick)
+	if err == ErrFileNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
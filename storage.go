@@ -7,6 +7,7 @@ import (
 	"github.com/monkey92t/go_fastdfs/pool"
 	"io"
 	"sync"
+	"time"
 )
 
 type Request interface {
@@ -17,6 +18,7 @@ type Response interface {
 }
 
 type Storage struct {
+	client     *FastdfsClient
 	addr       string
 	groupName  string
 	remoteName string
@@ -26,14 +28,43 @@ type Storage struct {
 	closed     bool
 }
 
+//获取storage的连接，返回连接所属的连接池
+//连接池在查询storage之后被registry淘汰时，重新获取一次
+func (s *Storage) getConn() (*pool.ConnPool, *pool.Conn, error) {
+	s.mu.Lock()
+	p := s.connPool
+	s.mu.Unlock()
+
+	conn, err := s.client.getConn(p)
+	if err != pool.ErrClosed {
+		return p, conn, err
+	}
+
+	p, err = s.client.getStoragePool(s.addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.mu.Lock()
+	s.connPool = p
+	s.mu.Unlock()
+
+	conn, err = s.client.getConn(p)
+	return p, conn, err
+}
+
 //下载的数据流，写入到w
-func (s *Storage) downloadToWrite(w io.Writer, offset, downloadSize int64) (int, error) {
-	conn, err := getConn(s.connPool)
+//verify不为nil时，在完整接收后调用，返回错误则丢弃连接
+func (s *Storage) downloadToWrite(w io.Writer, offset, downloadSize int64, verify func() error) (_ int, err error) {
+	s.client.limits.waitRequest(s.addr)
+
+	p, conn, err := s.getConn()
 	if err != nil {
 		return 0, err
 	}
 
-	defer closeConn(s.connPool, conn)
+	defer func() {
+		s.client.releaseConn(p, conn, err)
+	}()
 
 	//构建tracker
 	th := buildTrackerHeader(STORAGE_PROTO_CMD_DOWNLOAD_FILE, int64(FDFS_PROTO_PKG_LEN_SIZE*2+FDFS_GROUP_NAME_MAX_LEN+len(s.remoteName)))
@@ -41,11 +72,14 @@ func (s *Storage) downloadToWrite(w io.Writer, offset, downloadSize int64) (int,
 	request := downloadRequestMarshal(offset, downloadSize, s.groupName, s.remoteName)
 	buff.Write(request)
 
+	opt := s.client.opt
+	conn.SetWriteTimeout(opt.WriteTimeout)
 	_, err = conn.Write(buff.Bytes())
 	if err != nil {
 		return 0, err
 	}
 
+	conn.SetReadTimeout(opt.ReadTimeout)
 	if err := th.recvHeader(conn, STORAGE_PROTO_CMD_RESP, -1); err != nil {
 		return 0, err
 	}
@@ -54,20 +88,29 @@ func (s *Storage) downloadToWrite(w io.Writer, offset, downloadSize int64) (int,
 	readsize := 0
 	buf := make([]byte, 32*1024)
 	var downerr error
-	for {
-		nr, err := conn.Reader.Read(buf)
+	//先检查长度再读取，body为空时不会阻塞到超时
+	for int64(readsize) < th.pkgLen {
+		n := len(buf)
+		if left := th.pkgLen - int64(readsize); left < int64(n) {
+			n = int(left)
+		}
+		//每次读取都重新计算超时，只要数据在持续传输就不会超时
+		conn.SetReadTimeout(opt.StreamIdleTimeout)
+		nr, err := conn.Reader.Read(buf[:n])
 		if nr > 0 {
+			s.client.limits.waitBytes(s.addr, nr)
 			readsize += nr
 			nw, ew := w.Write(buf[0:nr])
 			if nw > 0 {
 				writesize += nw
 			}
+			//写入w失败是调用方的问题，不计入熔断，也不重试
 			if ew != nil {
-				downerr = ew
+				downerr = &permanentError{ew}
 				break
 			}
 			if nr != nw {
-				downerr = errors.New("short write.")
+				downerr = &permanentError{errors.New("short write.")}
 				break
 			}
 		}
@@ -77,20 +120,111 @@ func (s *Storage) downloadToWrite(w io.Writer, offset, downloadSize int64) (int,
 			}
 			break
 		}
-		if int64(readsize) >= th.pkgLen {
-			break
-		}
 	}
 
 	if int64(readsize) != th.pkgLen {
-		//抹除conn
-		s.connPool.Remove(conn)
+		if downerr == nil {
+			downerr = io.ErrUnexpectedEOF
+		}
+		//抹除conn，读取storage的网络错误计入熔断
+		if IsRetryableError(downerr) {
+			p.ReportFailure()
+		}
+		p.Remove(conn)
 		conn = nil
+	} else if downerr == nil && verify != nil {
+		if downerr = verify(); downerr != nil {
+			p.Remove(conn)
+			conn = nil
+		}
 	}
 
 	return writesize, downerr
 }
 
+//从存储服务器查询文件信息
+//flags为FDFS_QUERY_FINFO_FLAGS_*，放在header的status中发送
+func (s *Storage) queryFileInfo(flags int8) (_ *FileInfo, err error) {
+	s.client.limits.waitRequest(s.addr)
+
+	p, conn, err := s.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		s.client.releaseConn(p, conn, err)
+	}()
+
+	groupBytes := buildGroupName(s.groupName)
+
+	th := buildTrackerHeader(STORAGE_PROTO_CMD_QUERY_FILE_INFO, int64(len(groupBytes)+len(s.remoteName)))
+	th.status = flags
+
+	whole := new(bytes.Buffer)
+	whole.Write(th.bytes())
+	whole.Write(groupBytes)
+	whole.WriteString(s.remoteName)
+
+	conn.SetWriteTimeout(s.client.opt.WriteTimeout)
+	_, err = conn.Write(whole.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetReadTimeout(s.client.opt.ReadTimeout)
+	buff, err := th.recvPackage(conn, STORAGE_PROTO_CMD_RESP, 3*FDFS_PROTO_PKG_LEN_SIZE+FDFS_IPADDR_SIZE)
+	if err != nil {
+		return nil, err
+	}
+
+	fsize := buffToInt64(buff, 0)
+	ctime := buffToInt64(buff, FDFS_PROTO_PKG_LEN_SIZE)
+	crc32 := int(buffToInt64(buff, 2*FDFS_PROTO_PKG_LEN_SIZE))
+	start := 3 * FDFS_PROTO_PKG_LEN_SIZE
+	end := start + FDFS_IPADDR_SIZE
+	ipaddr := string(readStr(buff[start:end]))
+
+	return &FileInfo{
+		Address:    s.client.mapAddr(ipaddr),
+		CreateTime: time.Unix(ctime, 0),
+		FileSize:   fsize,
+		Crc32:      crc32,
+	}, nil
+}
+
+//从存储服务器删除文件
+//删除不是幂等操作，调用方不应重试
+func (s *Storage) deleteFile() (err error) {
+	s.client.limits.waitRequest(s.addr)
+
+	p, conn, err := s.getConn()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		s.client.releaseConn(p, conn, err)
+	}()
+
+	groupBytes := buildGroupName(s.groupName)
+
+	th := buildTrackerHeader(STORAGE_PROTO_CMD_DELETE_FILE, int64(len(groupBytes)+len(s.remoteName)))
+	whole := new(bytes.Buffer)
+	whole.Write(th.bytes())
+	whole.Write(groupBytes)
+	whole.WriteString(s.remoteName)
+
+	conn.SetWriteTimeout(s.client.opt.WriteTimeout)
+	_, err = conn.Write(whole.Bytes())
+	if err != nil {
+		return err
+	}
+
+	conn.SetReadTimeout(s.client.opt.ReadTimeout)
+	return th.recvHeader(conn, STORAGE_PROTO_CMD_RESP, 0)
+}
+
 func downloadRequestMarshal(offset, downloadSize int64, gn, rn string) []byte {
 	buf := new(bytes.Buffer)
 	binary.Write(buf, binary.BigEndian, offset)
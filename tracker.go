@@ -8,6 +8,8 @@ import (
 	"io"
 )
 
+var ErrFileNotFound = errors.New("fastdfs: file not found")
+
 //fastdfs tracker
 
 type trackerHeader struct {
@@ -52,11 +54,14 @@ func (th *trackerHeader) recvHeader(conn *pool.Conn, cmd int8, needLen int64) er
 	}
 
 	if b[PROTO_HEADER_STATUS_INDEX] != 0 {
+		if b[PROTO_HEADER_STATUS_INDEX] == FDFS_ERR_ENOENT {
+			return ErrFileNotFound
+		}
 		return errors.New("Recv tracker header error, The status code is not 0." + fmt.Sprint(th))
 	}
 
 	if b[PROTO_HEADER_CMD_INDEX] != byte(cmd) {
-		es := fmt.Sprintf("recv cmd error:", b[FDFS_PROTO_PKG_LEN_SIZE], "is not correct.", "expect cmd:", cmd)
+		es := fmt.Sprint("recv cmd error:", b[FDFS_PROTO_PKG_LEN_SIZE], "is not correct.", "expect cmd:", cmd)
 		return errors.New(es)
 	}
 